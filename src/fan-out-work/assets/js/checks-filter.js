@@ -0,0 +1,14 @@
+// Narrows the pull requests of a status down to the rows with failing checks while its data-checks-filter
+// checkbox is ticked, without fetching the status again.
+htmx.onLoad(function (content) {
+    content.querySelectorAll("[data-checks-filter]").forEach(function (checkbox) {
+        const status = checkbox.closest("#status");
+        const filter = function () {
+            status.querySelectorAll("tr[data-checks]").forEach(function (row) {
+                row.hidden = checkbox.checked && row.dataset.checks !== "failing";
+            });
+        };
+        checkbox.addEventListener("change", filter);
+        filter();
+    });
+});
@@ -0,0 +1,14 @@
+// Follows run output streamed as server-sent events by elements with a data-output-stream URL, swapping each
+// rendered chunk of output into the end of the element.
+htmx.onLoad(function (content) {
+    content.querySelectorAll("[data-output-stream]").forEach(function (target) {
+        const source = new EventSource(target.dataset.outputStream);
+        source.addEventListener("output", function (event) {
+            htmx.swap(target, event.data, { swapStyle: "beforeend" });
+        });
+        source.addEventListener("done", function (event) {
+            source.close();
+            htmx.swap(target, event.data, { swapStyle: "beforeend" });
+        });
+    });
+});
@@ -2,6 +2,11 @@ module github.com/bradshjg/fan-out-work
 
 go 1.25.0
 
+require (
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/sync v0.16.0
+)
+
 require (
 	github.com/PuerkitoBio/goquery v1.10.3 // indirect
 	github.com/a-h/parse v0.0.0-20250122154542-74294addb73e // indirect
@@ -32,7 +37,6 @@ require (
 	golang.org/x/mod v0.26.0 // indirect
 	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/oauth2 v0.31.0 // indirect
-	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 	golang.org/x/text v0.27.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
@@ -4,15 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/a-h/templ"
 	"github.com/bradshjg/fan-out-work/middleware"
 	"github.com/bradshjg/fan-out-work/services"
 	"github.com/bradshjg/fan-out-work/views"
 	"github.com/labstack/echo/v4"
 )
 
-const StopPollingStatus = 286
-
 func NewFanoutHandler(fanoutService services.FanoutService) *FanoutHandler {
 	return &FanoutHandler{
 		fanoutService: fanoutService,
@@ -38,20 +42,72 @@ func (fh *FanoutHandler) HomeHandler(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("error getting patches: %w", err)
 	}
-	return renderView(c, views.Index(true, orgs, patches))
+	return renderView(c, views.Index(true, orgs, patches, fh.fanoutService.PatchesLoadedAt()))
 }
 
 func (fh *FanoutHandler) reAuthenticate(c echo.Context) error {
 	lc := c.(*middleware.SLoggerContext)
 	lc.SLogger().Info("forcing re-authentication")
 	fh.fanoutService.ClearSession(c)
-	return renderView(c, views.Index(false, []string{}, []string{}))
+	return renderView(c, views.Index(false, []string{}, []services.Patch{}, time.Time{}))
 }
 
 type Patch struct {
-	Org    string `form:"org"`
-	Name   string `form:"patch"`
-	DryRun bool   `form:"dry-run"`
+	Org      string `form:"org"`
+	Name     string `form:"patch"`
+	DryRun   bool   `form:"dry-run"`
+	RunID    string `form:"run"`
+	DryRunID string `form:"dry-run-id"`
+	Targets
+	SelectRepos bool     `form:"select-repos"`
+	Selected    []string `form:"selected"`
+}
+
+// Targets are the run form's optional overrides of a patch's configured targets; lists are separated by commas
+// or whitespace.
+type Targets struct {
+	Repos    string `form:"repos"`
+	Topics   string `form:"topics"`
+	Search   string `form:"search"`
+	Language string `form:"language"`
+	Archived string `form:"archived"`
+	Forks    string `form:"forks"`
+	Include  string `form:"include"`
+	Exclude  string `form:"exclude"`
+}
+
+func (t Targets) targets() services.Targets {
+	return services.Targets{
+		Repos:    splitList(t.Repos),
+		Topics:   splitList(t.Topics),
+		Search:   strings.TrimSpace(t.Search),
+		Language: strings.TrimSpace(t.Language),
+		Archived: services.TargetFilter(t.Archived),
+		Forks:    services.TargetFilter(t.Forks),
+		Include:  splitList(t.Include),
+		Exclude:  splitList(t.Exclude),
+	}
+}
+
+// parameterPrefix marks the form fields holding a patch's parameters, e.g. param-version.
+const parameterPrefix = "param-"
+
+// parameters picks the parameters out of a form. The last value given for a parameter wins, since a bool's
+// checkbox follows a hidden false that's only there for when it's unticked.
+func parameters(form url.Values) map[string]string {
+	values := map[string]string{}
+	for key, given := range form {
+		if name, ok := strings.CutPrefix(key, parameterPrefix); ok && len(given) > 0 {
+			values[name] = given[len(given)-1]
+		}
+	}
+	return values
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
 }
 
 func (fh *FanoutHandler) RunHandler(c echo.Context) error {
@@ -64,17 +120,56 @@ func (fh *FanoutHandler) RunHandler(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("error getting access token: %w", err)
 	}
+	user, err := fh.fanoutService.User(c)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
 	pr := services.PatchRun{
 		AccessToken: token,
+		User:        user,
 		Org:         patch.Org,
 		Patch:       patch.Name,
 		DryRun:      patch.DryRun,
+		Targets:     patch.targets(),
+		SelectRepos: patch.SelectRepos,
+		Selected:    patch.Selected,
+		Parameters:  parameters(form),
+		DryRunID:    patch.DryRunID,
 	}
-	outputToken, err := fh.fanoutService.Run(pr)
+	outputToken, err := fh.fanoutService.Run(c, pr)
 	if err != nil {
+		if errors.Is(err, services.ErrNoReposSelected) || errors.Is(err, services.ErrInvalidParameter) || errors.Is(err, services.ErrPatchChanged) ||
+			errors.Is(err, services.ErrDryRunRequired) || errors.Is(err, services.ErrParametersChanged) {
+			return renderView(c, views.OutputError(err))
+		}
 		return fmt.Errorf("error handling run: %w", err)
 	}
-	return renderView(c, views.Run(outputToken, patch.Org, patch.Name, patch.DryRun))
+	return renderView(c, views.Run(outputToken))
+}
+
+type Parameters struct {
+	Patch string `query:"patch"`
+}
+
+// ParametersHandler renders the fields for the parameters of the patch picked in the dry run form.
+func (fh *FanoutHandler) ParametersHandler(c echo.Context) error {
+	var parameters Parameters
+	err := c.Bind(&parameters)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	if parameters.Patch == "" {
+		return renderView(c, views.ParameterFields([]services.Parameter{}))
+	}
+	params, err := fh.fanoutService.Parameters(parameters.Patch)
+	if err != nil {
+		return fmt.Errorf("error getting parameters: %w", err)
+	}
+	return renderView(c, views.ParameterFields(params))
 }
 
 func (fh *FanoutHandler) StatusHandler(c echo.Context) error {
@@ -91,37 +186,311 @@ func (fh *FanoutHandler) StatusHandler(c echo.Context) error {
 		AccessToken: token,
 		Org:         patch.Org,
 		Patch:       patch.Name,
+		RunID:       patch.RunID,
 	}
-	issueLink, err := fh.fanoutService.Status(c, pr)
+	report, err := fh.fanoutService.Status(c, pr)
 	if err != nil {
 		if errors.Is(err, services.ErrRepoMissing) {
-			return renderView(c, views.Status("", err))
+			return renderView(c, views.Status(patch.Org, patch.Name, report, err))
+		} else if errors.Is(err, services.ErrRunNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
 		} else {
 			return fmt.Errorf("error handling status: %w", err)
 		}
 	}
-	return renderView(c, views.Status(issueLink, nil))
+	return renderView(c, views.Status(patch.Org, patch.Name, report, nil))
+}
+
+type Merge struct {
+	Org    string   `form:"org"`
+	Patch  string   `form:"patch"`
+	Method string   `form:"method"`
+	Repos  []string `form:"repos"`
+}
+
+// MergePreviewHandler shows which of a patch's open PRs a merge would merge.
+func (fh *FanoutHandler) MergePreviewHandler(c echo.Context) error {
+	var merge Merge
+	err := c.Bind(&merge)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	candidates, err := fh.fanoutService.MergePreview(c, merge.Org, merge.Patch)
+	if err != nil {
+		return fmt.Errorf("error previewing merge: %w", err)
+	}
+	return renderView(c, views.MergePreview(merge.Org, merge.Patch, candidates))
+}
+
+func (fh *FanoutHandler) MergeHandler(c echo.Context) error {
+	var merge Merge
+	err := c.Bind(&merge)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	token, err := fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+	user, err := fh.fanoutService.User(c)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	mr := services.MergeRun{
+		AccessToken: token,
+		User:        user,
+		Org:         merge.Org,
+		Patch:       merge.Patch,
+		Method:      services.MergeMethod(merge.Method),
+		Repos:       merge.Repos,
+	}
+	outputToken, err := fh.fanoutService.Merge(c, mr)
+	if err != nil {
+		if errors.Is(err, services.ErrNoReposSelected) || errors.Is(err, services.ErrInvalidMergeMethod) || errors.Is(err, services.ErrNothingToMerge) {
+			return renderView(c, views.OutputError(err))
+		}
+		return fmt.Errorf("error handling merge: %w", err)
+	}
+	return renderView(c, views.Run(outputToken))
+}
+
+type Withdraw struct {
+	Org            string `form:"org"`
+	Patch          string `form:"patch"`
+	Comment        string `form:"comment"`
+	DeleteBranches bool   `form:"delete-branches"`
+}
+
+func (fh *FanoutHandler) WithdrawHandler(c echo.Context) error {
+	var withdraw Withdraw
+	err := c.Bind(&withdraw)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	token, err := fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+	user, err := fh.fanoutService.User(c)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	wr := services.WithdrawRun{
+		AccessToken:    token,
+		User:           user,
+		Org:            withdraw.Org,
+		Patch:          withdraw.Patch,
+		Comment:        withdraw.Comment,
+		DeleteBranches: withdraw.DeleteBranches,
+	}
+	outputToken, err := fh.fanoutService.Withdraw(c, wr)
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToWithdraw) {
+			return renderView(c, views.OutputError(err))
+		}
+		return fmt.Errorf("error handling withdrawal: %w", err)
+	}
+	return renderView(c, views.Run(outputToken))
+}
+
+type Refresh struct {
+	Org      string `form:"org"`
+	Patch    string `form:"patch"`
+	Strategy string `form:"strategy"`
+}
+
+func (fh *FanoutHandler) RefreshHandler(c echo.Context) error {
+	var refresh Refresh
+	err := c.Bind(&refresh)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	token, err := fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+	user, err := fh.fanoutService.User(c)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	rr := services.RefreshRun{
+		AccessToken: token,
+		User:        user,
+		Org:         refresh.Org,
+		Patch:       refresh.Patch,
+		Strategy:    services.RefreshStrategy(refresh.Strategy),
+	}
+	outputToken, err := fh.fanoutService.Refresh(c, rr)
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToRefresh) || errors.Is(err, services.ErrInvalidRefreshStrategy) || errors.Is(err, services.ErrInvalidParameter) ||
+			errors.Is(err, services.ErrNoRunToReplace) || errors.Is(err, services.ErrPatchChangedSinceRun) {
+			return renderView(c, views.OutputError(err))
+		}
+		return fmt.Errorf("error handling refresh: %w", err)
+	}
+	return renderView(c, views.Run(outputToken))
 }
 
 type Output struct {
-	Org    string `query:"org"`
-	Patch  string `query:"patch"`
-	DryRun bool   `query:"dry-run"`
 	Token  string `query:"token"`
+	Cursor int    `query:"cursor"`
 }
 
+// OutputHandler streams a run's output as server-sent events: an "output" event carrying rendered output for
+// each batch of lines, and a final "done" event once the run has finished.
 func (fh *FanoutHandler) OutputHandler(c echo.Context) error {
 	var output Output
 	err := c.Bind(&output)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
 	}
-	lines, done, err := fh.fanoutService.Output(output.Token)
+	// a reconnecting client resumes from the last cursor it received
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		output.Cursor, err = strconv.Atoi(lastEventID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid Last-Event-ID: %w", err)
+		}
+	}
+	// an event stream can't be sent to the login page, so there's nothing to do but refuse
+	_, err = fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+	w := c.Response()
+	// streams are long-lived, unlike the requests the server's write timeout is meant for
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("error clearing write deadline: %w", err)
+	}
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.WriteHeader(http.StatusOK)
+	ctx := c.Request().Context()
+	err = fh.fanoutService.Stream(c, output.Token, output.Cursor, func(out services.RunOutput) error {
+		return writeEvent(ctx, w, "output", strconv.Itoa(out.Cursor), views.Output(out.Lines, out.Run))
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// the client went away
+			return nil
+		}
+		return writeEvent(ctx, w, "done", "", views.OutputError(err))
+	}
+	return writeEvent(ctx, w, "done", "", templ.NopComponent)
+}
+
+type Cancel struct {
+	Token string `form:"token"`
+}
+
+func (fh *FanoutHandler) CancelHandler(c echo.Context) error {
+	var cancel Cancel
+	err := c.Bind(&cancel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	_, err = fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fh.reAuthenticate(c)
+	}
+	err = fh.fanoutService.Cancel(c, cancel.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrRunNotRunning) {
+			return renderView(c, views.Cancelled(err))
+		}
+		if errors.Is(err, services.ErrRunNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return fmt.Errorf("error cancelling run: %w", err)
+	}
+	return renderView(c, views.Cancelled(nil))
+}
+
+type History struct {
+	Org   string `query:"org"`
+	Patch string `query:"patch"`
+}
+
+func (fh *FanoutHandler) HistoryHandler(c echo.Context) error {
+	var history History
+	err := c.Bind(&history)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	_, err = fh.fanoutService.AccessToken(c)
 	if err != nil {
-		return fmt.Errorf("error getting output: %w", err)
+		return fh.reAuthenticate(c)
+	}
+	runs, err := fh.fanoutService.History(c, history.Org, history.Patch)
+	if err != nil {
+		return fmt.Errorf("error getting history: %w", err)
+	}
+	return renderView(c, views.History(runs, history.Org, history.Patch))
+}
+
+type Catalog struct {
+	Tag string `query:"tag"`
+}
+
+// CatalogHandler lists the patches with what they do and who owns them, optionally only those with a tag.
+func (fh *FanoutHandler) CatalogHandler(c echo.Context) error {
+	var catalog Catalog
+	err := c.Bind(&catalog)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	_, err = fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fh.reAuthenticate(c)
+	}
+	patches, err := fh.fanoutService.Patches()
+	if err != nil {
+		return fmt.Errorf("error getting patches: %w", err)
+	}
+	return renderView(c, views.Catalog(patches, catalog.Tag))
+}
+
+type Campaign struct {
+	Org   string `query:"org"`
+	Patch string `query:"patch"`
+}
+
+// CampaignHandler shows how far a patch has got in an org.
+func (fh *FanoutHandler) CampaignHandler(c echo.Context) error {
+	var campaign Campaign
+	err := c.Bind(&campaign)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	_, err = fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fh.reAuthenticate(c)
+	}
+	dashboard, err := fh.fanoutService.Campaign(c, campaign.Org, campaign.Patch)
+	if err != nil {
+		if errors.Is(err, services.ErrOrgNotFound) || errors.Is(err, services.ErrPatchNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return fmt.Errorf("error getting campaign: %w", err)
+	}
+	return renderView(c, views.Campaign(dashboard))
+}
+
+func (fh *FanoutHandler) ReplayHandler(c echo.Context) error {
+	_, err := fh.fanoutService.AccessToken(c)
+	if err != nil {
+		return fh.reAuthenticate(c)
+	}
+	run, lines, err := fh.fanoutService.Replay(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrRunNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return fmt.Errorf("error getting run: %w", err)
 	}
-	if done {
-		c.Response().Writer.WriteHeader(StopPollingStatus) // HTMX handles the semantics here
+	if !run.Done() {
+		// follow the run live from the start rather than showing a snapshot
+		return renderView(c, views.Follow(run))
 	}
-	return renderView(c, views.Output(lines, output.Org, output.Patch, output.DryRun, done))
+	return renderView(c, views.Replay(run, lines))
 }
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/bradshjg/fan-out-work/services"
@@ -21,25 +24,148 @@ func (*mockFanoutService) AccessToken(c echo.Context) (string, error) {
 	return "access-token", nil
 }
 
+func (*mockFanoutService) User(c echo.Context) (string, error) {
+	return "octocat", nil
+}
+
 func (*mockFanoutService) Orgs(c echo.Context) ([]string, error) {
 	orgs := []string{"howdy", "there"}
 	return orgs, nil
 }
 
-func (*mockFanoutService) Patches() ([]string, error) {
-	return []string{"foo", "bar"}, nil
+func (*mockFanoutService) Patches() ([]services.Patch, error) {
+	patches := []services.Patch{
+		{
+			Name:        "foo",
+			Description: "Bumps the Go version",
+			Owner:       "@acme/platform",
+			Tags:        []string{"go", "deps"},
+			README:      "# Foo\n\nRun it with `PATCH_VERSION` set.\n\n- see [the docs](https://go.dev)\n- <script>alert(1)</script>\n",
+		},
+		{Name: "bar", Tags: []string{"ci"}, Deprecated: true},
+		{Name: "broken", Problem: errors.New("patch must be executable")},
+	}
+	return patches, nil
+}
+
+func (*mockFanoutService) PatchesLoadedAt() time.Time {
+	return time.Date(2025, 9, 22, 12, 0, 0, 0, time.UTC)
+}
+
+func (*mockFanoutService) Parameters(patch string) ([]services.Parameter, error) {
+	params := []services.Parameter{
+		{Name: "version", Type: services.ParameterSemver, Required: true},
+		{Name: "channel", Type: services.ParameterEnum, Values: []string{"stable", "beta"}, Default: "beta"},
+		{Name: "cleanup", Type: services.ParameterBool, Default: "true"},
+	}
+	return params, nil
 }
 
-func (*mockFanoutService) Run(pr services.PatchRun) (string, error) {
+var capturedPatchRun services.PatchRun
+
+func (*mockFanoutService) Run(c echo.Context, pr services.PatchRun) (string, error) {
+	capturedPatchRun = pr
 	return "output token", nil
 }
 
-func (*mockFanoutService) Status(c echo.Context, pr services.PatchRun) (string, error) {
-	return "issue link", nil
+func (*mockFanoutService) Status(c echo.Context, pr services.PatchRun) (services.StatusReport, error) {
+	report := services.StatusReport{
+		IssueURL: "issue link",
+		PullRequests: []services.PullRequest{
+			{Repo: "howdy/repo", Number: 1, URL: "pr link", State: services.PullRequestOpen, ReviewState: services.ReviewStateApproved, Checks: services.CheckStatePassing},
+			{Repo: "howdy/broken", Number: 2, URL: "pr link", State: services.PullRequestOpen, ReviewState: services.ReviewStateNone, Checks: services.CheckStateFailing},
+		},
+	}
+	return report, nil
+}
+
+func (*mockFanoutService) Output(token string, cursor int) (services.RunOutput, error) {
+	run := services.RunRecord{ID: token, Status: services.RunStatusSucceeded}
+	return services.RunOutput{Lines: []string{}, Cursor: cursor, Run: run}, nil
 }
 
-func (*mockFanoutService) Output(token string) ([]string, bool, error) {
-	return []string{}, true, nil
+func (*mockFanoutService) Stream(c echo.Context, token string, cursor int, send func(services.RunOutput) error) error {
+	running := services.RunRecord{ID: token, Status: services.RunStatusRunning}
+	if err := send(services.RunOutput{Lines: []string{"line 1"}, Cursor: cursor + 1, Run: running}); err != nil {
+		return err
+	}
+	done := services.RunRecord{ID: token, Status: services.RunStatusSucceeded, DryRun: true, Results: []services.RepoResult{
+		{Repo: "howdy/api", Outcome: services.RepoOutcomeSucceeded},
+		{Repo: "howdy/web", Outcome: services.RepoOutcomeNoChange},
+	}}
+	return send(services.RunOutput{Lines: []string{"line 2"}, Cursor: cursor + 2, Run: done})
+}
+
+func (*mockFanoutService) Cancel(c echo.Context, token string) error {
+	if token == "hidden-run" {
+		return services.ErrRunNotFound
+	}
+	return nil
+}
+
+func (*mockFanoutService) History(c echo.Context, org string, patch string) ([]services.RunRecord, error) {
+	runs := []services.RunRecord{
+		{ID: "run-1", User: "octocat", Org: "howdy", Patch: "foo", DryRun: true, Status: services.RunStatusSucceeded},
+		{ID: "run-2", User: "octocat", Org: "there", Patch: "bar", Status: services.RunStatusFailed},
+	}
+	return runs, nil
+}
+
+func (*mockFanoutService) Replay(c echo.Context, id string) (services.RunRecord, []string, error) {
+	return services.RunRecord{ID: id}, []string{"line 1", "line 2"}, nil
+}
+
+func (*mockFanoutService) MergePreview(c echo.Context, org string, patch string) ([]services.MergeCandidate, error) {
+	candidates := []services.MergeCandidate{
+		{PullRequest: services.PullRequest{Repo: "howdy/api", Number: 1, URL: "pr 1"}},
+		{PullRequest: services.PullRequest{Repo: "howdy/web", Number: 2, URL: "pr 2"}, Reason: "its checks haven't passed"},
+	}
+	return candidates, nil
+}
+
+var capturedMergeRun services.MergeRun
+
+func (*mockFanoutService) Merge(c echo.Context, mr services.MergeRun) (string, error) {
+	capturedMergeRun = mr
+	return "merge-1", nil
+}
+
+var capturedWithdrawRun services.WithdrawRun
+
+func (*mockFanoutService) Withdraw(c echo.Context, wr services.WithdrawRun) (string, error) {
+	capturedWithdrawRun = wr
+	return "withdraw-1", nil
+}
+
+var capturedRefreshRun services.RefreshRun
+
+func (*mockFanoutService) Refresh(c echo.Context, rr services.RefreshRun) (string, error) {
+	capturedRefreshRun = rr
+	if rr.Strategy != services.RefreshRebase && rr.Strategy != services.RefreshReplace {
+		return "", services.ErrInvalidRefreshStrategy
+	}
+	return "refresh-1", nil
+}
+
+func (*mockFanoutService) Campaign(c echo.Context, org string, patch string) (services.Campaign, error) {
+	if org != "howdy" {
+		return services.Campaign{}, services.ErrOrgNotFound
+	}
+	campaign := services.Campaign{
+		Org:   org,
+		Patch: patch,
+		Runs: []services.RunRecord{
+			{ID: "run-1", User: "octocat", Org: "howdy", Patch: "foo", Status: services.RunStatusSucceeded, IssueURL: "issue link"},
+		},
+		StatusReport: services.StatusReport{
+			IssueURL: "issue link",
+			PullRequests: []services.PullRequest{
+				{Repo: "howdy/api", Number: 1, URL: "pr 1", State: services.PullRequestOpen, Checks: services.CheckStateFailing},
+				{Repo: "howdy/web", Number: 2, URL: "pr 2", State: services.PullRequestMerged},
+			},
+		},
+	}
+	return campaign, nil
 }
 
 func TestHomeHandler(t *testing.T) {
@@ -64,5 +190,338 @@ func TestHomeHandler(t *testing.T) {
 		if text := selection.Text(); text != expectedText {
 			t.Errorf("Expected text '%s', got '%s'", expectedText, text)
 		}
+
+		_, disabled := doc.Find(`[data-testid="patches"] option[value="broken"]`).Attr("disabled")
+		assert.True(t, disabled, "Expected broken patches not to be selectable")
+		broken := doc.Find(`[data-testid="broken-patch"]`)
+		assert.Equal(t, 1, broken.Length())
+		assert.Contains(t, broken.Text(), "patch must be executable")
+		assert.Equal(t, "patches loaded 2025-09-22 12:00:00", doc.Find(`[data-testid="patches-loaded-at"]`).Text())
+		assert.Equal(t, "bar (deprecated)", doc.Find(`[data-testid="patches"] option[value="bar"]`).Text())
+		title, _ := doc.Find(`[data-testid="patches"] option[value="foo"]`).Attr("title")
+		assert.Equal(t, "Bumps the Go version", title)
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/patches", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.CatalogHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		patches := doc.Find(`[data-testid="catalog-patch"]`)
+		assert.Equal(t, 3, patches.Length())
+		foo := patches.First()
+		assert.Equal(t, "Bumps the Go version", foo.Find(`[data-testid="description"]`).Text())
+		assert.Equal(t, "owned by @acme/platform", foo.Find(`[data-testid="owner"]`).Text())
+		readme := foo.Find(`[data-testid="readme"]`)
+		assert.Equal(t, "Foo", readme.Find("h3").Text())
+		assert.Equal(t, "PATCH_VERSION", readme.Find("p code").Text())
+		link, _ := readme.Find("li a").Attr("href")
+		assert.Equal(t, "https://go.dev", link)
+		assert.Equal(t, 0, readme.Find("script").Length(), "Expected the README to be escaped")
+		assert.Equal(t, 1, doc.Find(`#bar [data-testid="deprecated"]`).Length())
+		assert.Equal(t, "tags: ci deps go", strings.Join(strings.Fields(doc.Find(`[data-testid="catalog-tags"]`).Text()), " "))
+	}
+}
+
+func TestCatalogHandlerTag(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/patches?tag=go", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.CatalogHandler(c)) {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		patches := doc.Find(`[data-testid="catalog-patch"]`)
+		assert.Equal(t, 1, patches.Length())
+		id, _ := patches.Attr("id")
+		assert.Equal(t, "foo", id)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	e := echo.New()
+	form := url.Values{"org": {"howdy"}, "patch": {"foo"}, "run": {"run-1"}}
+	req := httptest.NewRequest(http.MethodPost, "/status", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.StatusHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		rows := doc.Find(`[data-testid="pull-requests"] tbody tr`)
+		assert.Equal(t, 2, rows.Length())
+		assert.Equal(t, "failing", rows.Last().Find(`[data-testid="checks"]`).Text())
+		checks, _ := rows.Last().Attr("data-checks")
+		assert.Equal(t, "failing", checks, "Expected rows to carry their checks for filtering")
+		filter := doc.Find(`[data-testid="failing-only"]`)
+		assert.Contains(t, filter.Text(), "failing checks (1)")
+		assert.Equal(t, 1, filter.Find("[data-checks-filter]").Length())
+		assert.Equal(t, 0, filter.ParentsFiltered("[hx-post]").Length(), "Expected filtering not to fetch the status again")
+	}
+}
+
+func TestCampaignHandler(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/campaign?org=howdy&patch=foo", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.CampaignHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		for label, count := range map[string]string{"opened": "2", "open": "1", "merged": "1", "closed": "0", "failing": "1", "no change": "0"} {
+			assert.Equal(t, count, doc.Find(`[data-testid="count-`+label+`"] b`).Text(), "Expected %s count", label)
+		}
+		value, _ := doc.Find(`[data-testid="progress"] progress`).Attr("value")
+		assert.Equal(t, "50", value)
+		link, _ := doc.Find(`[data-testid="tracking-issue"]`).Attr("href")
+		assert.Equal(t, "issue link", link)
+		assert.Equal(t, 2, doc.Find(`[data-testid="pull-requests"] tbody tr`).Length())
+		assert.Equal(t, 1, doc.Find(`[data-testid="history"] tbody tr`).Length())
+		refresh, _ := doc.Find(`#campaign button`).Attr("hx-get")
+		assert.Equal(t, "/campaign?org=howdy&patch=foo", refresh)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/campaign?org=there&patch=foo", nil)
+	c = e.NewContext(req, httptest.NewRecorder())
+	err := h.CampaignHandler(c)
+	var httpErr *echo.HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/history", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.HistoryHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		rows := doc.Find(`[data-testid="history"] tbody tr`)
+		assert.Equal(t, 2, rows.Length())
+		link, _ := rows.First().Find(`a[data-testid="replay"]`).Attr("href")
+		assert.Equal(t, "/runs/run-1", link)
+	}
+}
+
+func TestOutputHandler(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/output?token=run-1", nil)
+	req.Header.Set("Last-Event-ID", "3")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.OutputHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+		events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+		if assert.Len(t, events, 3) {
+			assert.True(t, strings.HasPrefix(events[0], "event: output\nid: 4\n"), "Expected to resume from Last-Event-ID, got %q", events[0])
+			assert.Contains(t, events[0], "line 1")
+			assert.True(t, strings.HasPrefix(events[1], "event: output\nid: 5\n"), "Expected second output event, got %q", events[1])
+			assert.Contains(t, events[1], `hx-post="/run"`, "Expected the run form once the dry run is done")
+			assert.Contains(t, events[1], `name="selected" value="howdy/api" checked`, "Expected changed repositories to be selectable")
+			assert.NotContains(t, events[1], `value="howdy/web"`, "Expected unchanged repositories to be left out")
+			assert.True(t, strings.HasPrefix(events[2], "event: done\n"), "Expected done event, got %q", events[2])
+		}
+	}
+}
+
+func TestCancelHandler(t *testing.T) {
+	e := echo.New()
+	h := NewFanoutHandler(&mockFanoutService{})
+	form := url.Values{"token": {"run-1"}}
+	req := httptest.NewRequest(http.MethodPost, "/cancel", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if assert.NoError(t, h.CancelHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	form.Set("token", "hidden-run")
+	req = httptest.NewRequest(http.MethodPost, "/cancel", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	c = e.NewContext(req, httptest.NewRecorder())
+	err := h.CancelHandler(c)
+	var httpErr *echo.HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
+
+func TestRunHandlerTargets(t *testing.T) {
+	e := echo.New()
+	form := url.Values{
+		"org":           {"howdy"},
+		"patch":         {"foo"},
+		"dry-run":       {"true"},
+		"repos":         {"api, web\nworker"},
+		"archived":      {"exclude"},
+		"exclude":       {"*-legacy"},
+		"param-version": {"1.2.3"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.RunHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		targets := capturedPatchRun.Targets
+		assert.Equal(t, []string{"api", "web", "worker"}, targets.Repos)
+		assert.Equal(t, services.TargetFilterExclude, targets.Archived)
+		assert.Equal(t, []string{"*-legacy"}, targets.Exclude)
+		assert.Empty(t, targets.Topics)
+		assert.Equal(t, map[string]string{"version": "1.2.3"}, capturedPatchRun.Parameters)
+	}
+}
+
+func TestMergePreviewHandler(t *testing.T) {
+	e := echo.New()
+	form := url.Values{"org": {"howdy"}, "patch": {"foo"}}
+	req := httptest.NewRequest(http.MethodPost, "/merge/preview", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.MergePreviewHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		_, checked := doc.Find(`input[name="repos"][value="howdy/api"]`).Attr("checked")
+		assert.True(t, checked, "Expected mergeable PRs to be ticked")
+		_, disabled := doc.Find(`input[name="repos"][value="howdy/web"]`).Attr("disabled")
+		assert.True(t, disabled, "Expected PRs that can't be merged not to be selectable")
+		assert.Equal(t, "its checks haven't passed", doc.Find(`[data-testid="merge-blocked"]`).Text())
+	}
+}
+
+func TestMergeHandler(t *testing.T) {
+	e := echo.New()
+	form := url.Values{"org": {"howdy"}, "patch": {"foo"}, "method": {"squash"}, "repos": {"howdy/api"}}
+	req := httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.MergeHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, services.MergeMethodSquash, capturedMergeRun.Method)
+		assert.Equal(t, []string{"howdy/api"}, capturedMergeRun.Repos)
+		assert.Contains(t, rec.Body.String(), "/output?token=merge-1")
+	}
+}
+
+func TestWithdrawHandler(t *testing.T) {
+	e := echo.New()
+	form := url.Values{"org": {"howdy"}, "patch": {"foo"}, "comment": {"this breaks the build"}, "delete-branches": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, "/withdraw", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.WithdrawHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "this breaks the build", capturedWithdrawRun.Comment)
+		assert.True(t, capturedWithdrawRun.DeleteBranches)
+		assert.Contains(t, rec.Body.String(), "/output?token=withdraw-1")
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	e := echo.New()
+	form := url.Values{"org": {"howdy"}, "patch": {"foo"}, "strategy": {"replace"}}
+	req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.RefreshHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, services.RefreshReplace, capturedRefreshRun.Strategy)
+		assert.Contains(t, rec.Body.String(), "/output?token=refresh-1")
+	}
+
+	form.Set("strategy", "merge")
+	req = httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if assert.NoError(t, h.RefreshHandler(c)) {
+		assert.Contains(t, rec.Body.String(), `data-testid="output-error"`)
+	}
+}
+
+func TestParametersHandler(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/parameters?patch=foo", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := NewFanoutHandler(&mockFanoutService{})
+	if assert.NoError(t, h.ParametersHandler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("Failed to create goquery document: %v", err)
+		}
+		params := doc.Find(`[data-testid="parameters"]`)
+		_, required := params.Find(`input[name="param-version"]`).Attr("required")
+		assert.True(t, required, "Expected the version to be required")
+		selected := params.Find(`select[name="param-channel"] option[selected]`).Text()
+		assert.Equal(t, "beta", selected)
+		cleanup := params.Find(`input[name="param-cleanup"]`)
+		if assert.Equal(t, 2, cleanup.Length()) {
+			value, _ := cleanup.First().Attr("value")
+			assert.Equal(t, "false", value, "Expected an unticked checkbox to submit false")
+			_, checked := cleanup.Last().Attr("checked")
+			assert.True(t, checked, "Expected the checkbox to be ticked by default")
+		}
+	}
+}
+
+func TestRunHandlerBoolParameter(t *testing.T) {
+	e := echo.New()
+	h := NewFanoutHandler(&mockFanoutService{})
+	for _, tc := range []struct {
+		given    []string
+		expected string
+	}{
+		{[]string{"false"}, "false"},        // unticked
+		{[]string{"false", "true"}, "true"}, // ticked
+	} {
+		form := url.Values{"org": {"howdy"}, "patch": {"foo"}, "dry-run": {"true"}, "param-cleanup": tc.given}
+		req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		c := e.NewContext(req, httptest.NewRecorder())
+		if assert.NoError(t, h.RunHandler(c)) {
+			assert.Equal(t, tc.expected, capturedPatchRun.Parameters["cleanup"])
+		}
 	}
 }
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/a-h/templ"
 	"github.com/labstack/echo/v4"
@@ -13,6 +17,28 @@ func renderView(c echo.Context, cmp templ.Component) error {
 	return cmp.Render(c.Request().Context(), c.Response().Writer)
 }
 
+// writeEvent writes a rendered component as a server-sent event and flushes it to the client.
+func writeEvent(ctx context.Context, w *echo.Response, event string, id string, cmp templ.Component) error {
+	var buf bytes.Buffer
+	if err := cmp.Render(ctx, &buf); err != nil {
+		return err
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "event: %s\n", event)
+	if id != "" {
+		fmt.Fprintf(&msg, "id: %s\n", id)
+	}
+	for line := range strings.SplitSeq(buf.String(), "\n") {
+		fmt.Fprintf(&msg, "data: %s\n", line)
+	}
+	msg.WriteString("\n")
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
 func RouteNotFoundHandler(c echo.Context) error {
 	return c.String(http.StatusNotFound, "404 Not Found")
 }
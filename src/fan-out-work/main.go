@@ -14,6 +14,15 @@ import (
 )
 
 func main() {
+	// fan-out-work validate [patches directory] checks patches without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		dir := services.PatchDir()
+		if len(os.Args) > 2 {
+			dir = os.Args[2]
+		}
+		os.Exit(validate(dir, os.Stdout))
+	}
+
 	e := echo.New()
 
 	e.Debug = os.Getenv("DEBUG") == "true"
@@ -44,17 +53,41 @@ func main() {
 
 	e.Static("/static", "assets")
 
+	runStoreDir := os.Getenv("RUN_STORE_DIR")
+	if runStoreDir == "" {
+		runStoreDir = "./runs"
+	}
+	rs, err := services.NewFileRunStore(runStoreDir)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
 	os := services.NewOauthService(sessionStore)
 	gs := services.NewGitHubService(os)
-	fs := services.NewFanoutService(gs)
+	// broken patches are logged whenever the catalog loads them
+	pc, err := services.NewPatchCatalog(services.NewPatchSource())
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	fs := services.NewFanoutService(gs, rs, pc)
 
 	fh := handlers.NewFanoutHandler(fs)
 	gh := handlers.NewGitHubHandler(os)
 
 	e.GET("/", fh.HomeHandler)
 	e.POST("/run", fh.RunHandler)
+	e.GET("/parameters", fh.ParametersHandler)
+	e.GET("/patches", fh.CatalogHandler)
 	e.POST("/status", fh.StatusHandler)
+	e.POST("/merge/preview", fh.MergePreviewHandler)
+	e.POST("/merge", fh.MergeHandler)
+	e.POST("/withdraw", fh.WithdrawHandler)
+	e.POST("/refresh", fh.RefreshHandler)
 	e.GET("/output", fh.OutputHandler)
+	e.POST("/cancel", fh.CancelHandler)
+	e.GET("/history", fh.HistoryHandler)
+	e.GET("/runs/:id", fh.ReplayHandler)
+	e.GET("/campaign", fh.CampaignHandler)
 	e.GET("/github/login", gh.OAuthHandler)
 	e.GET("/github/callback", gh.OAuthCallbackHandler)
 	e.GET("/*", handlers.RouteNotFoundHandler)
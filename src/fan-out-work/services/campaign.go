@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrOrgNotFound = errors.New("org not found")
+
+// Campaign is how far a patch has got in an org: its runs, and the live state of its PRs.
+type Campaign struct {
+	Org   string
+	Patch string
+	Runs  []RunRecord // most recent first
+	StatusReport
+}
+
+// Count counts the PRs in a state.
+func (c Campaign) Count(state PullRequestState) int {
+	count := 0
+	for _, pr := range c.PullRequests {
+		if pr.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+// NoChange counts the repositories the latest run of the patch left alone because the patch didn't change them.
+func (c Campaign) NoChange() int {
+	for _, r := range c.Runs {
+		if r.Kind != RunKindPatch || r.DryRun || !r.Done() {
+			continue
+		}
+		count := 0
+		for _, result := range r.Results {
+			if result.Outcome == RepoOutcomeNoChange {
+				count++
+			}
+		}
+		return count
+	}
+	return 0
+}
+
+// Progress is the percentage of the patch's PRs that are done with, whether merged or closed.
+func (c Campaign) Progress() int {
+	if len(c.PullRequests) == 0 {
+		return 0
+	}
+	return (c.Count(PullRequestMerged) + c.Count(PullRequestClosed)) * 100 / len(c.PullRequests)
+}
+
+// Campaign gathers the state of a patch in an org. Unlike Status, it only reads the tracking issue's link from
+// the runs rather than creating or updating the issue.
+func (fs *FanoutServiceImpl) Campaign(c echo.Context, org string, patch string) (Campaign, error) {
+	orgs, err := fs.Orgs(c)
+	if err != nil {
+		return Campaign{}, err
+	}
+	if !slices.Contains(orgs, org) {
+		return Campaign{}, fmt.Errorf("%w: %s", ErrOrgNotFound, org)
+	}
+	p, err := fs.patch(patch)
+	if err != nil {
+		return Campaign{}, err
+	}
+	token, err := fs.AccessToken(c)
+	if err != nil {
+		return Campaign{}, err
+	}
+	runs, err := fs.history(orgs, org, patch)
+	if err != nil {
+		return Campaign{}, err
+	}
+	pullRequests, err := fs.githubService.PullRequests(token, org, p.cfg.Branch, p.cfg.headOwner(org))
+	if err != nil {
+		return Campaign{}, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	err = fs.checkPullRequests(token, pullRequests)
+	if err != nil {
+		return Campaign{}, err
+	}
+	campaign := Campaign{
+		Org:          org,
+		Patch:        patch,
+		Runs:         runs,
+		StatusReport: StatusReport{PullRequests: pullRequests},
+	}
+	for _, r := range runs {
+		if r.IssueURL != "" {
+			campaign.IssueURL = r.IssueURL
+			break
+		}
+	}
+	return campaign, nil
+}
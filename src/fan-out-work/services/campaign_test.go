@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaign(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "howdy/repo-1", Number: 1, URL: "pr 1", State: PullRequestOpen, HeadSHA: "abc123"},
+		{Repo: "howdy/repo-2", Number: 2, URL: "pr 2", State: PullRequestMerged},
+		{Repo: "howdy/repo-3", Number: 3, URL: "pr 3", State: PullRequestClosed},
+		{Repo: "howdy/repo-4", Number: 4, URL: "pr 4", State: PullRequestMerged},
+	}
+	fs := NewMockFanoutService(t)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	now := time.Now()
+	for _, r := range []RunRecord{
+		{ID: "dry-run", Org: "howdy", Patch: "example", DryRun: true, Status: RunStatusSucceeded, StartedAt: now.Add(-3 * time.Hour),
+			Results: []RepoResult{{Repo: "howdy/repo-5", Outcome: RepoOutcomeNoChange}, {Repo: "howdy/repo-6", Outcome: RepoOutcomeNoChange}}},
+		{ID: "run", Org: "howdy", Patch: "example", Status: RunStatusSucceeded, StartedAt: now.Add(-2 * time.Hour), IssueURL: "issue link",
+			Results: []RepoResult{{Repo: "howdy/repo-5", Outcome: RepoOutcomeNoChange}}},
+		{ID: "merge", Kind: RunKindMerge, Org: "howdy", Patch: "example", Status: RunStatusSucceeded, StartedAt: now.Add(-time.Hour)},
+		{ID: "elsewhere", Org: "there", Patch: "example", Status: RunStatusSucceeded, StartedAt: now},
+	} {
+		if err := runStore.Create(r); err != nil {
+			t.Fatalf("creating run: %v", err)
+		}
+	}
+
+	orgsCalls = 0
+	campaign, err := fs.Campaign(newContext(), "howdy", "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, 1, orgsCalls, "Expected the user's orgs to be looked up once")
+	assert.Len(t, campaign.Runs, 3)
+	assert.Equal(t, "issue link", campaign.IssueURL)
+	assert.Equal(t, 1, campaign.Count(PullRequestOpen))
+	assert.Equal(t, 2, campaign.Count(PullRequestMerged))
+	assert.Equal(t, 1, campaign.Count(PullRequestClosed))
+	assert.Len(t, campaign.Failing(), 1)
+	assert.Equal(t, 1, campaign.NoChange(), "Expected the latest real run's results to count")
+	assert.Equal(t, 75, campaign.Progress())
+
+	_, err = fs.Campaign(newContext(), "gh-org", "example")
+	assert.ErrorIs(t, err, ErrOrgNotFound)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// catalogReloadDelay lets a burst of changes, such as a volume being updated, settle before patches are
+// reloaded.
+const catalogReloadDelay = 250 * time.Millisecond
+
+// PatchCatalog caches the validated patches of a source, reloading them whenever anything in the source's
+// directory changes so that patches can be updated without restarting the server.
+type PatchCatalog struct {
+	source   PatchSource
+	dir      string
+	watcher  *fsnotify.Watcher
+	mu       sync.RWMutex
+	patches  []Patch
+	loadedAt time.Time
+}
+
+func NewPatchCatalog(source PatchSource) (*PatchCatalog, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error watching patches: %w", err)
+	}
+	pc := &PatchCatalog{source: source, dir: source.Dir(), watcher: watcher}
+	err = pc.reload()
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go pc.watch()
+	return pc, nil
+}
+
+// list returns the patches as of the last reload, and when that was.
+func (pc *PatchCatalog) list() ([]Patch, time.Time) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.patches, pc.loadedAt
+}
+
+func (pc *PatchCatalog) Close() error {
+	return pc.watcher.Close()
+}
+
+// reload validates the patches again and watches any new patch folders. The previous patches are kept if the
+// directory can't be read.
+func (pc *PatchCatalog) reload() error {
+	patches, err := ValidatePatches(pc.dir)
+	if err != nil {
+		return fmt.Errorf("error loading patches: %w", err)
+	}
+	// fsnotify doesn't watch recursively, and changes to a config.yml or patch happen inside a patch folder
+	watched := pc.watcher.WatchList()
+	for _, dir := range append([]string{pc.dir}, patchDirs(pc.dir, patches)...) {
+		if !slices.ContainsFunc(watched, func(w string) bool { return filepath.Clean(w) == filepath.Clean(dir) }) {
+			if err := pc.watcher.Add(dir); err != nil {
+				return fmt.Errorf("error watching %s: %w", dir, err)
+			}
+		}
+	}
+	pc.mu.Lock()
+	pc.patches = patches
+	pc.loadedAt = time.Now()
+	pc.mu.Unlock()
+	for _, p := range patches {
+		if !p.Valid() {
+			log.Printf("patch %s is broken: %v", p.Name, p.Problem)
+		}
+	}
+	return nil
+}
+
+func (pc *PatchCatalog) watch() {
+	var timer *time.Timer
+	reload := make(chan struct{}, 1)
+	for {
+		select {
+		case _, ok := <-pc.watcher.Events:
+			if !ok {
+				return
+			}
+			if timer == nil {
+				timer = time.AfterFunc(catalogReloadDelay, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				timer.Reset(catalogReloadDelay)
+			}
+		case <-reload:
+			if err := pc.reload(); err != nil {
+				log.Printf("error reloading patches, keeping the previous ones: %v", err)
+			}
+		case err, ok := <-pc.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("error watching patches: %v", err)
+		}
+	}
+}
+
+func patchDirs(dir string, patches []Patch) []string {
+	var dirs []string
+	for _, p := range patches {
+		dirs = append(dirs, filepath.Join(dir, p.Name))
+	}
+	return dirs
+}
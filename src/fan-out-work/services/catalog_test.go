@@ -0,0 +1,46 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchCatalogReload(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "example", "branch: b\npr-title: t\n")
+	pc, err := NewPatchCatalog(NewLocalPatchSource(dir))
+	if err != nil {
+		t.Fatalf("creating catalog: %v", err)
+	}
+	defer pc.Close()
+	patches, loadedAt := pc.list()
+	if assert.Len(t, patches, 1) {
+		assert.True(t, patches[0].Valid())
+		assert.Equal(t, "t", patches[0].cfg.PRTitle)
+	}
+
+	// break the existing patch and add a new one
+	err = os.WriteFile(filepath.Join(dir, "example", "config.yml"), []byte("branch: b\n"), 0o644)
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	writePatch(t, dir, "other", "branch: b\npr-title: other\n")
+	assert.Eventually(t, func() bool {
+		patches, reloadedAt := pc.list()
+		return len(patches) == 2 && !patches[0].Valid() && reloadedAt.After(loadedAt)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// changes inside the new patch are picked up too
+	err = os.WriteFile(filepath.Join(dir, "other", "config.yml"), []byte("branch: b\npr-title: changed\n"), 0o644)
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	assert.Eventually(t, func() bool {
+		patches, _ := pc.list()
+		return len(patches) == 2 && patches[1].cfg.PRTitle == "changed"
+	}, 5*time.Second, 10*time.Millisecond)
+}
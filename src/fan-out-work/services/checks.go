@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CheckState sums up the CI of a PR's head commit: its commit statuses and check runs.
+type CheckState string
+
+const (
+	CheckStateNone    CheckState = "no checks"
+	CheckStatePending CheckState = "pending"
+	CheckStatePassing CheckState = "passing"
+	CheckStateFailing CheckState = "failing"
+)
+
+// commitStatusState maps the state of a commit status onto a CheckState.
+func commitStatusState(state string) CheckState {
+	switch state {
+	case "success":
+		return CheckStatePassing
+	case "failure", "error":
+		return CheckStateFailing
+	default:
+		return CheckStatePending
+	}
+}
+
+// checkRunState maps the status and conclusion of a check run onto a CheckState. Neutral and skipped runs
+// don't hold a PR up, so they count as passing.
+func checkRunState(status string, conclusion string) CheckState {
+	if status != "completed" {
+		return CheckStatePending
+	}
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return CheckStatePassing
+	default:
+		return CheckStateFailing
+	}
+}
+
+// combineCheckStates sums up the states of a commit's checks: any failing check fails the lot, and otherwise
+// any pending one leaves it pending.
+func combineCheckStates(states []CheckState) CheckState {
+	switch {
+	case len(states) == 0:
+		return CheckStateNone
+	case slices.Contains(states, CheckStateFailing):
+		return CheckStateFailing
+	case slices.Contains(states, CheckStatePending):
+		return CheckStatePending
+	default:
+		return CheckStatePassing
+	}
+}
+
+// checkPullRequests fills in the CI state of open PRs; the checks of merged and closed PRs no longer matter.
+func (fs *FanoutServiceImpl) checkPullRequests(token string, pullRequests []PullRequest) error {
+	var g errgroup.Group
+	g.SetLimit(githubConcurrency)
+	for i, pr := range pullRequests {
+		if pr.State != PullRequestOpen {
+			continue
+		}
+		g.Go(func() error {
+			checks, err := fs.githubService.Checks(token, pr.Repo, pr.HeadSHA)
+			if err != nil {
+				return fmt.Errorf("error getting checks of %s #%d: %w", pr.Repo, pr.Number, err)
+			}
+			pullRequests[i].Checks = checks
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// Failing lists the PRs whose checks are failing.
+func (r StatusReport) Failing() []PullRequest {
+	var failing []PullRequest
+	for _, pr := range r.PullRequests {
+		if pr.Checks == CheckStateFailing {
+			failing = append(failing, pr)
+		}
+	}
+	return failing
+}
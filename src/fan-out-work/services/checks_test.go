@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombineCheckStates(t *testing.T) {
+	assert.Equal(t, CheckStateNone, combineCheckStates(nil))
+	assert.Equal(t, CheckStatePassing, combineCheckStates([]CheckState{
+		commitStatusState("success"),
+		checkRunState("completed", "skipped"),
+	}))
+	assert.Equal(t, CheckStatePending, combineCheckStates([]CheckState{
+		commitStatusState("success"),
+		checkRunState("in_progress", ""),
+	}))
+	assert.Equal(t, CheckStateFailing, combineCheckStates([]CheckState{
+		commitStatusState("pending"),
+		checkRunState("completed", "timed_out"),
+	}))
+	assert.Equal(t, CheckStateFailing, combineCheckStates([]CheckState{commitStatusState("error")}))
+}
+
+func TestStatusChecks(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/repo-1", Number: 1, URL: "pr 1", State: PullRequestOpen, HeadSHA: "abc123"},
+		{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestOpen},
+	}
+	capturedIssue = Issue{}
+	fs := NewMockFanoutService(t)
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	report, err := fs.Status(c, PatchRun{AccessToken: "gh-api-token", Org: "gh-org", Patch: "example"})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	failing := report.Failing()
+	assert.Len(t, failing, 1)
+	assert.Equal(t, "gh-org/repo-1", failing[0].Repo)
+	assert.Equal(t, "\n- [ ] pr 1 (checks failing)\n- [ ] pr 2", capturedIssue.Body)
+}
+
+func TestCheckPullRequests(t *testing.T) {
+	// more PRs than are checked at once, to check they're each filled in whatever order the checks finish in
+	var pullRequests []PullRequest
+	for i := range 3 * githubConcurrency {
+		pr := PullRequest{Repo: fmt.Sprintf("gh-org/repo-%d", i), Number: i, State: PullRequestOpen, HeadSHA: fmt.Sprintf("sha-%d", i)}
+		switch i % 3 {
+		case 1:
+			pr.HeadSHA = ""
+		case 2:
+			pr.State = PullRequestMerged
+		}
+		pullRequests = append(pullRequests, pr)
+	}
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	err := fs.checkPullRequests("gh-api-token", pullRequests)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	for i, pr := range pullRequests {
+		assert.Equal(t, fmt.Sprintf("gh-org/repo-%d", i), pr.Repo)
+		switch i % 3 {
+		case 0:
+			assert.Equal(t, CheckStateFailing, pr.Checks)
+		case 1:
+			assert.Equal(t, CheckStateNone, pr.Checks)
+		case 2:
+			assert.Equal(t, CheckState(""), pr.Checks, "Expected the checks of merged PRs to be left out")
+		}
+	}
+}
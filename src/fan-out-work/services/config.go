@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ConflictStrategy string
+
+const (
+	// ConflictStrategySkip leaves a repository alone when its PR branch already exists and has diverged.
+	ConflictStrategySkip    ConflictStrategy = "skip"
+	ConflictStrategyReplace ConflictStrategy = "replace"
+)
+
+// config is a patch's config.yml; see patches/example/config.yml for what each option means.
+type config struct {
+	Description      string           `yaml:"description"`
+	Owner            string           `yaml:"owner"`
+	Tags             []string         `yaml:"tags"`
+	Deprecated       bool             `yaml:"deprecated"`
+	Branch           string           `yaml:"branch"`
+	PRTitle          string           `yaml:"pr-title"`
+	PRBody           string           `yaml:"pr-body"`
+	CommitMessage    string           `yaml:"commit-message"`
+	BaseBranch       string           `yaml:"base-branch"`
+	Reviewers        []string         `yaml:"reviewers"`
+	TeamReviewers    []string         `yaml:"team-reviewers"`
+	MaxReviewers     int              `yaml:"max-reviewers"`
+	MaxTeamReviewers int              `yaml:"max-team-reviewers"`
+	Assignees        []string         `yaml:"assignees"`
+	Labels           []string         `yaml:"labels"`
+	Draft            bool             `yaml:"draft"`
+	Fork             bool             `yaml:"fork"`
+	ForkOwner        string           `yaml:"fork-owner"`
+	ConflictStrategy ConflictStrategy `yaml:"conflict-strategy"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	Targets          Targets          `yaml:"targets"`
+	Parameters       []Parameter      `yaml:"parameters"`
+}
+
+// parseConfig reads a config.yml, rejecting options it doesn't know about as well as invalid values.
+func parseConfig(data []byte) (config, error) {
+	var cfg config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return config{}, err
+	}
+	err = cfg.validate()
+	if err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+func (cfg config) validate() error {
+	var errs []error
+	if cfg.Branch == "" {
+		errs = append(errs, errors.New("branch is required"))
+	}
+	if cfg.PRTitle == "" {
+		errs = append(errs, errors.New("pr-title is required"))
+	}
+	if _, err := prTemplate("pr-title", cfg.PRTitle); err != nil {
+		errs = append(errs, fmt.Errorf("invalid pr-title template: %w", err))
+	}
+	if _, err := prTemplate("pr-body", cfg.PRBody); err != nil {
+		errs = append(errs, fmt.Errorf("invalid pr-body template: %w", err))
+	}
+	if cfg.BaseBranch != "" && cfg.BaseBranch == cfg.Branch {
+		errs = append(errs, errors.New("base-branch must differ from branch"))
+	}
+	for _, list := range []struct {
+		option string
+		names  []string
+	}{
+		{"reviewers", cfg.Reviewers},
+		{"team-reviewers", cfg.TeamReviewers},
+		{"assignees", cfg.Assignees},
+		{"labels", cfg.Labels},
+		{"tags", cfg.Tags},
+	} {
+		if slices.ContainsFunc(list.names, func(name string) bool { return strings.TrimSpace(name) == "" }) {
+			errs = append(errs, fmt.Errorf("%s can't contain empty entries", list.option))
+		}
+	}
+	if cfg.MaxReviewers < 0 {
+		errs = append(errs, errors.New("max-reviewers can't be negative"))
+	}
+	if cfg.MaxTeamReviewers < 0 {
+		errs = append(errs, errors.New("max-team-reviewers can't be negative"))
+	}
+	if cfg.ForkOwner != "" && !cfg.Fork {
+		errs = append(errs, errors.New("fork-owner requires fork"))
+	}
+	if cfg.Fork && cfg.ForkOwner == "" {
+		// otherwise the forks belong to whoever ran the patch, and nobody else could find its PRs
+		errs = append(errs, errors.New("fork requires fork-owner"))
+	}
+	switch cfg.ConflictStrategy {
+	case "", ConflictStrategySkip, ConflictStrategyReplace:
+	default:
+		errs = append(errs, fmt.Errorf("invalid conflict-strategy %q, expected %q or %q", cfg.ConflictStrategy, ConflictStrategySkip, ConflictStrategyReplace))
+	}
+	if cfg.Timeout < 0 {
+		errs = append(errs, errors.New("timeout can't be negative"))
+	}
+	if err := validateParameterDeclarations(cfg.Parameters); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// headOwner is who owns the branches a patch's PRs are opened from: the org, unless they're pushed to forks.
+func (cfg config) headOwner(org string) string {
+	if cfg.Fork {
+		return cfg.ForkOwner
+	}
+	return org
+}
+
+// args maps the PR options onto multi-gitter's flags, leaving out those that aren't set so that multi-gitter's
+// defaults apply.
+func (cfg config) args() []string {
+	var args []string
+	if cfg.CommitMessage != "" {
+		args = append(args, "--commit-message", cfg.CommitMessage)
+	}
+	if cfg.BaseBranch != "" {
+		args = append(args, "--base-branch", cfg.BaseBranch)
+	}
+	if len(cfg.Reviewers) > 0 {
+		args = append(args, "--reviewers", strings.Join(cfg.Reviewers, ","))
+	}
+	if len(cfg.TeamReviewers) > 0 {
+		args = append(args, "--team-reviewers", strings.Join(cfg.TeamReviewers, ","))
+	}
+	if cfg.MaxReviewers > 0 {
+		args = append(args, "--max-reviewers", strconv.Itoa(cfg.MaxReviewers))
+	}
+	if cfg.MaxTeamReviewers > 0 {
+		args = append(args, "--max-team-reviewers", strconv.Itoa(cfg.MaxTeamReviewers))
+	}
+	if len(cfg.Assignees) > 0 {
+		args = append(args, "--assignees", strings.Join(cfg.Assignees, ","))
+	}
+	if len(cfg.Labels) > 0 {
+		args = append(args, "--labels", strings.Join(cfg.Labels, ","))
+	}
+	if cfg.Draft {
+		args = append(args, "--draft")
+	}
+	if cfg.Fork {
+		args = append(args, "--fork")
+	}
+	if cfg.ForkOwner != "" {
+		args = append(args, "--fork-owner", cfg.ForkOwner)
+	}
+	if cfg.ConflictStrategy != "" {
+		args = append(args, "--conflict-strategy", string(cfg.ConflictStrategy))
+	}
+	return args
+}
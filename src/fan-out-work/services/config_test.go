@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+branch: update-deps
+pr-title: Update dependencies
+commit-message: Update dependencies
+base-branch: develop
+reviewers: [octocat, hubot]
+team-reviewers: [platform]
+max-reviewers: 1
+assignees: [octocat]
+labels: [dependencies, automated]
+draft: true
+fork: true
+fork-owner: acme-bot
+conflict-strategy: replace
+`))
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	expectedArgs := []string{
+		"--commit-message", "Update dependencies",
+		"--base-branch", "develop",
+		"--reviewers", "octocat,hubot",
+		"--team-reviewers", "platform",
+		"--max-reviewers", "1",
+		"--assignees", "octocat",
+		"--labels", "dependencies,automated",
+		"--draft",
+		"--fork",
+		"--fork-owner", "acme-bot",
+		"--conflict-strategy", "replace",
+	}
+	assert.Equal(t, expectedArgs, cfg.args())
+}
+
+func TestParseConfigUnknownOption(t *testing.T) {
+	_, err := parseConfig([]byte("branch: b\npr-title: t\nreviewer: octocat\n"))
+	assert.ErrorContains(t, err, "field reviewer not found")
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	_, err := parseConfig([]byte("pr-title: t\nfork-owner: octocat\nconflict-strategy: merge\nlabels: ['']\n"))
+	assert.EqualError(t, err, `branch is required
+labels can't contain empty entries
+fork-owner requires fork
+invalid conflict-strategy "merge", expected "skip" or "replace"`)
+
+	_, err = parseConfig([]byte("branch: b\npr-title: t\nfork: true\n"))
+	assert.EqualError(t, err, "fork requires fork-owner")
+}
+
+func TestConfigHeadOwner(t *testing.T) {
+	assert.Equal(t, "gh-org", config{}.headOwner("gh-org"))
+	assert.Equal(t, "acme-bot", config{Fork: true, ForkOwner: "acme-bot"}.headOwner("gh-org"))
+}
@@ -1,73 +1,137 @@
 package services
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/stretchr/testify/assert/yaml"
 )
 
+// DefaultPatchDir is where patches are read from, relative to the working directory.
+const DefaultPatchDir = "./patches"
+
 var (
-	outputMap = sync.Map{}
-	patchDir  = "./patches"
+	runningProcesses = sync.Map{}
+	patchDir         = stringFromEnv("PATCH_DIR", DefaultPatchDir)
 )
 
-type config struct {
-	Branch  string `yaml:"branch"`
-	PRTitle string `yaml:"pr-title"`
-	PRBody  string `yaml:"pr-body"`
-}
+// defaultRunTimeout applies to patches that don't configure their own timeout.
+var defaultRunTimeout = durationFromEnv("RUN_TIMEOUT", time.Hour)
 
 type PatchRun struct {
 	AccessToken string
+	User        string
 	Org         string
 	Patch       string
 	DryRun      bool
+	RunID       string            // the run a status check follows up on, if any
+	Targets     Targets           // overrides the patch's configured targets
+	SelectRepos bool              // restricts the run to Selected rather than its targets
+	Selected    []string          // repositories picked from a dry run's results
+	Parameters  map[string]string // values for the parameters the patch declares
+	DryRunID    string            // the dry run a real run follows up on, if any
+	refresh     *replaceRefresh   // regenerates the branches of open PRs, set by Refresh
 }
 
 type FanoutService interface {
 	ClearSession(c echo.Context)
 	AccessToken(c echo.Context) (string, error)
+	User(c echo.Context) (string, error)
 	Orgs(c echo.Context) ([]string, error)
-	Patches() ([]string, error)
-	Run(pr PatchRun) (string, error)
-	Status(c echo.Context, pr PatchRun) (string, error)
-	Output(token string) ([]string, bool, error)
+	Patches() ([]Patch, error)
+	PatchesLoadedAt() time.Time
+	Parameters(patch string) ([]Parameter, error)
+	Run(c echo.Context, pr PatchRun) (string, error)
+	Status(c echo.Context, pr PatchRun) (StatusReport, error)
+	Output(token string, cursor int) (RunOutput, error)
+	Stream(c echo.Context, token string, cursor int, send func(RunOutput) error) error
+	Cancel(c echo.Context, token string) error
+	History(c echo.Context, org string, patch string) ([]RunRecord, error)
+	Replay(c echo.Context, id string) (RunRecord, []string, error)
+	MergePreview(c echo.Context, org string, patch string) ([]MergeCandidate, error)
+	Merge(c echo.Context, mr MergeRun) (string, error)
+	Withdraw(c echo.Context, wr WithdrawRun) (string, error)
+	Refresh(c echo.Context, rr RefreshRun) (string, error)
+	Campaign(c echo.Context, org string, patch string) (Campaign, error)
 }
 
-func NewFanoutService(githubService GitHubService) *FanoutServiceImpl {
+func NewFanoutService(githubService GitHubService, runStore RunStore, catalog *PatchCatalog) *FanoutServiceImpl {
 	return &FanoutServiceImpl{
 		githubService: githubService,
+		runStore:      newLiveRunStore(runStore),
+		runQueue:      newRunQueue(maxConcurrentRuns, maxConcurrentRunsPerOrg),
+		catalog:       catalog,
+		snapshots:     snapshotsDir,
 	}
 }
 
+// PatchDir is where local patches are read from, DefaultPatchDir unless PATCH_DIR says otherwise.
+func PatchDir() string {
+	return patchDir
+}
+
 type executorRun struct {
 	args       []string
+	env        []string // added to the environment multi-gitter, and so the patch, runs in
 	streamName string
+	timeout    time.Duration
+	outcomes   map[RepoOutcome]RepoOutcome // renames the outcomes multi-gitter reports, if set
+	finish     func(results []RepoResult)  // called with the run's results before it's recorded as done, if set
+	done       func()                      // called once the run has been recorded as done, if set
 }
 
 type runExecutor interface {
 	Run(er executorRun) error
+	Cancel(streamName string) error
 }
 
-type executorStatus struct {
-	args []string
+func stringFromEnv(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
 }
 
-type statusExecutor interface {
-	Status(er executorStatus) ([]string, error)
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid duration %q for %s, using %v: %v", value, key, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid integer %q for %s, using %v: %v", value, key, fallback, err)
+		return fallback
+	}
+	return i
 }
 
 // generateStreamName generates a cryptographically secure random string for output streams.
@@ -81,99 +145,166 @@ func generateStreamName() (string, error) {
 	return name, nil
 }
 
-type runExecutorImpl struct{}
+var (
+	ErrRunCancelled    = errors.New("run cancelled")
+	ErrRunTimedOut     = errors.New("run timed out")
+	ErrRunNotRunning   = errors.New("run is not running")
+	ErrNoReposSelected = errors.New("no repositories selected")
+)
 
-func (ex *runExecutorImpl) Run(er executorRun) error {
-	cmd := exec.Command("multi-gitter", er.args...)
+// outputDrainTimeout bounds how long output is still collected once a run has been stopped.
+const outputDrainTimeout = 10 * time.Second
 
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
+type runExecutorImpl struct {
+	runStore RunStore
+}
 
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+func (ex *runExecutorImpl) Run(er executorRun) error {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	runCtx, stop := ctx, context.CancelFunc(func() {})
+	if er.timeout > 0 {
+		runCtx, stop = context.WithTimeoutCause(ctx, er.timeout, ErrRunTimedOut)
 	}
+	cmd := exec.CommandContext(runCtx, "multi-gitter", er.args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return signalProcessGroup(cmd, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = outputDrainTimeout
+	if len(er.env) > 0 {
+		cmd.Env = append(os.Environ(), er.env...)
+	}
+
+	stdout := ex.outputWriter(er.streamName)
+	stderr := ex.outputWriter(er.streamName)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	if err := cmd.Start(); err != nil {
+		stop()
+		cancel(err)
 		return err
 	}
-
-	ch := make(chan string, 10)
-	outputMap.Store(er.streamName, ch)
+	runningProcesses.Store(er.streamName, cancel)
 
 	go func() {
-		defer close(ch)
-		var wg sync.WaitGroup
-
-		wg.Go(func() {
-			collectOutput(ch, stdoutPipe)
-		})
-
-		wg.Go(func() {
-			collectOutput(ch, stderrPipe)
-		})
+		defer runningProcesses.Delete(er.streamName)
 
+		status := RunStatusSucceeded
 		if err := cmd.Wait(); err != nil {
 			log.Printf("command finished with error: %v", err)
+			status = RunStatusFailed
+		}
+		if runCtx.Err() != nil {
+			// reap anything in the process tree that outlived multi-gitter
+			if err := signalProcessGroup(cmd, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				log.Printf("error killing process group: %v", err)
+			}
+		}
+		var statusLine string
+		switch cause := context.Cause(runCtx); {
+		case errors.Is(cause, ErrRunCancelled):
+			status = RunStatusCancelled
+			statusLine = cause.Error()
+		case errors.Is(cause, ErrRunTimedOut):
+			status = RunStatusTimedOut
+			statusLine = fmt.Sprintf("%v after %v", cause, er.timeout)
+		}
+		stop()
+		cancel(nil)
+
+		// all output must be stored before the run is marked as done
+		stdout.Flush()
+		stderr.Flush()
+		if statusLine != "" {
+			if err := ex.runStore.Append(er.streamName, statusLine); err != nil {
+				log.Printf("error storing output: %v", err)
+			}
 		}
 
-		wg.Wait()
+		lines, err := ex.runStore.Output(er.streamName)
+		if err != nil {
+			log.Printf("error reading output: %v", err)
+		}
+		results := parseResults(lines)
+		for i, result := range results {
+			if outcome, ok := er.outcomes[result.Outcome]; ok {
+				results[i].Outcome = outcome
+			}
+		}
+		if er.finish != nil {
+			er.finish(results)
+		}
+		err = ex.runStore.Update(er.streamName, func(r *RunRecord) {
+			r.Status = status
+			r.EndedAt = time.Now()
+			r.ExitCode = cmd.ProcessState.ExitCode()
+			r.Results = results
+		})
+		if err != nil {
+			log.Printf("error recording run result: %v", err)
+		}
+		if er.done != nil {
+			er.done()
+		}
 	}()
 	return nil
 }
 
-func collectOutput(ch chan string, readPipe io.ReadCloser) {
-	scanner := bufio.NewScanner(readPipe)
-	for scanner.Scan() {
-		ch <- scanner.Text()
+// Cancel stops a running command; its remaining output is still collected and the run is marked as cancelled.
+func (ex *runExecutorImpl) Cancel(streamName string) error {
+	cancel, ok := runningProcesses.Load(streamName)
+	if !ok {
+		return ErrRunNotRunning
 	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("error reading pipe: %v", err)
+	cancel.(context.CancelCauseFunc)(ErrRunCancelled)
+	return nil
+}
+
+func (ex *runExecutorImpl) outputWriter(streamName string) *lineWriter {
+	return &lineWriter{
+		emit: func(line string) {
+			if err := ex.runStore.Append(streamName, line); err != nil {
+				log.Printf("error storing output: %v", err)
+			}
+		},
 	}
 }
 
-type statusExecutorImpl struct{}
+// lineWriter splits written output into lines, emitting each one as soon as it is complete.
+type lineWriter struct {
+	buf  []byte
+	emit func(line string)
+}
 
-func (ex *statusExecutorImpl) Status(er executorStatus) ([]string, error) {
-	cmd := exec.Command("multi-gitter", er.args...)
-	var output [][]byte
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return []string{}, err
-	}
-	if err := cmd.Start(); err != nil {
-		return []string{}, err
-	}
-	scanner := bufio.NewScanner(stdoutPipe)
-	for scanner.Scan() {
-		output = append(output, scanner.Bytes())
-	}
-	if err := scanner.Err(); err != nil {
-		return []string{}, err
-	}
-	if err := cmd.Wait(); err != nil {
-		return []string{}, err
-	}
-	var prLinks []string
-	// HACK multi-gitter only exposes the PR link as part of a terminal escape sequence; the run process
-	// asks for plain output, but here we assume terminal output and grab the links via regex.
-	// The format is documented at https://gist.github.com/egmontkob/eb114294efbcd5adb1944c9f3cb5feda
-	outputRegex := regexp.MustCompile(`^\x1B]8;;(.*?)\a`)
-	for _, line := range output {
-		matches := outputRegex.FindSubmatch(line)
-		if matches != nil {
-			prLinks = append(prLinks, string(matches[1]))
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
 		}
+		w.emit(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing output not terminated by a newline.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(strings.TrimSuffix(string(w.buf), "\r"))
+		w.buf = nil
 	}
-	return prLinks, nil
 }
 
 type FanoutServiceImpl struct {
-	githubService       GitHubService
-	patchRunExecutor    runExecutor
-	patchStatusExecutor statusExecutor
+	githubService    GitHubService
+	runStore         *liveRunStore
+	runQueue         *runQueue
+	patchRunExecutor runExecutor
+	snapshots        string        // where runs keep the copies of their patches they run
+	catalog          *PatchCatalog // patches are read from disk on every call when nil
 }
 
 func (fs *FanoutServiceImpl) ClearSession(c echo.Context) {
@@ -188,6 +319,14 @@ func (fs *FanoutServiceImpl) AccessToken(c echo.Context) (string, error) {
 	return token, nil
 }
 
+func (fs *FanoutServiceImpl) User(c echo.Context) (string, error) {
+	user, err := fs.githubService.User(c)
+	if err != nil {
+		return "", fmt.Errorf("error getting user: %w", err)
+	}
+	return user, nil
+}
+
 func (fs *FanoutServiceImpl) Orgs(c echo.Context) ([]string, error) {
 	orgs, err := fs.githubService.Orgs(c)
 	if err != nil {
@@ -196,183 +335,482 @@ func (fs *FanoutServiceImpl) Orgs(c echo.Context) ([]string, error) {
 	return orgs, nil
 }
 
-func (*FanoutServiceImpl) Patches() ([]string, error) {
-	var patches []string
-	entries, err := os.ReadDir(patchDir)
-	if err != nil {
-		return []string{}, err
-	}
-	for _, e := range entries {
-		if e.IsDir() {
-			patches = append(patches, e.Name())
-		}
+// Patches lists every patch, broken ones included so that the reason they can't be run can be shown.
+func (fs *FanoutServiceImpl) Patches() ([]Patch, error) {
+	if fs.catalog == nil {
+		return ValidatePatches(fs.patchDir())
 	}
+	patches, _ := fs.catalog.list()
 	return patches, nil
 }
 
-func (fs *FanoutServiceImpl) Run(pr PatchRun) (string, error) {
-	possiblePatches, err := fs.Patches()
+func (fs *FanoutServiceImpl) patchDir() string {
+	return fs.source().Dir()
+}
+
+func (fs *FanoutServiceImpl) source() PatchSource {
+	if fs.catalog == nil {
+		return NewLocalPatchSource(patchDir)
+	}
+	return fs.catalog.source
+}
+
+// PatchesLoadedAt is when the patches were last read from disk.
+func (fs *FanoutServiceImpl) PatchesLoadedAt() time.Time {
+	if fs.catalog == nil {
+		return time.Now()
+	}
+	_, loadedAt := fs.catalog.list()
+	return loadedAt
+}
+
+func (fs *FanoutServiceImpl) Run(c echo.Context, pr PatchRun) (_ string, err error) {
+	patch, err := fs.patch(pr.Patch)
 	if err != nil {
 		return "", err
 	}
-	if !slices.Contains(possiblePatches, pr.Patch) {
-		return "", fmt.Errorf("invalid patch name: %s", pr.Patch)
+	streamName, err := generateStreamName()
+	if err != nil {
+		return "", err
 	}
-	args, err := fs.runArgs(pr)
+	// the run records the revision it actually runs, which the source may have moved on from by the time it starts
+	snapshot, patchRevision, err := fs.snapshotPatch(streamName, patch.Name)
 	if err != nil {
 		return "", err
 	}
-	streamName, err := generateStreamName()
+	// the snapshot is only needed once the run has been queued
+	defer func() {
+		if err != nil {
+			fs.removeSnapshot(streamName)
+		}
+	}()
+	cfg, err := snapshotConfig(snapshot, patch.Name)
 	if err != nil {
 		return "", err
 	}
-	var runExecutor runExecutor
-	if fs.patchRunExecutor == nil {
-		runExecutor = &runExecutorImpl{}
-	} else {
-		runExecutor = fs.patchRunExecutor
+	patchHash, err := hashPatch(snapshot, patch.Name)
+	if err != nil {
+		return "", err
 	}
-	executorRun := executorRun{
-		args:       args,
-		streamName: streamName,
+	targets := cfg.Targets.merge(pr.Targets)
+	if pr.SelectRepos {
+		// the selection was made from repositories the targets already picked out
+		if len(pr.Selected) == 0 {
+			return "", ErrNoReposSelected
+		}
+		targets = Targets{Repos: pr.Selected}
 	}
-	err = runExecutor.Run(executorRun)
+	err = targets.validate(pr.Org)
 	if err != nil {
 		return "", err
 	}
-	return executorRun.streamName, nil
-}
-
-func (fs *FanoutServiceImpl) Status(c echo.Context, pr PatchRun) (string, error) {
-	possiblePatches, err := fs.Patches()
+	parameters, err := resolveParameters(cfg.Parameters, pr.Parameters)
 	if err != nil {
 		return "", err
 	}
-	if !slices.Contains(possiblePatches, pr.Patch) {
-		return "", fmt.Errorf("invalid patch name: %s", pr.Patch)
+	switch {
+	case pr.refresh != nil:
+		// a refresh regenerates PRs that a real run opened, so it may only make the changes that run made
+		if patchHash != pr.refresh.patchHash {
+			return "", ErrPatchChangedSinceRun
+		}
+	case !pr.DryRun:
+		err = fs.checkDryRun(pr, patchHash, parameters)
+		if err != nil {
+			return "", err
+		}
 	}
-	args, err := fs.statusArgs(pr)
+	targetArgs, err := fs.targetArgs(c, pr.Org, targets)
 	if err != nil {
 		return "", err
 	}
-	var statusExecutor statusExecutor
-	if fs.patchStatusExecutor == nil {
-		statusExecutor = &statusExecutorImpl{}
-	} else {
-		statusExecutor = fs.patchStatusExecutor
+	trackingIssueURL, err := fs.trackingIssueURL(pr.Org, pr.Patch)
+	if err != nil {
+		return "", err
 	}
-	executorStatus := executorStatus{
-		args: args,
+	templateData := PRTemplateData{
+		Owner:            pr.Org,
+		Patch:            pr.Patch,
+		RunID:            streamName,
+		User:             pr.User,
+		TrackingIssueURL: trackingIssueURL,
 	}
-	prLinks, err := statusExecutor.Status(executorStatus)
+	// PRs are opened with the parts of the templates common to every repository
+	rendered := cfg
+	rendered.PRTitle, rendered.PRBody, err = cfg.renderPR(templateData)
 	if err != nil {
 		return "", err
 	}
-	patchCfg, err := fs.patchConfig(pr)
+	kind, refreshStrategy := RunKindPatch, RefreshStrategy("")
+	if pr.refresh != nil {
+		// existing PR branches are regenerated rather than skipped
+		rendered.ConflictStrategy = ConflictStrategyReplace
+		kind, refreshStrategy = RunKindRefresh, RefreshReplace
+	}
+	args := fs.runArgs(pr, snapshot, rendered, targetArgs)
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultRunTimeout
+	}
+	executorRun := executorRun{
+		args:       args,
+		env:        parameterEnv(cfg.Parameters, parameters),
+		streamName: streamName,
+		timeout:    timeout,
+	}
+	switch {
+	case pr.refresh != nil:
+		executorRun.outcomes = map[RepoOutcome]RepoOutcome{RepoOutcomeSucceeded: RepoOutcomeUpdated}
+		executorRun.finish = fs.currentPullRequests(streamName, pr, cfg)
+	case !pr.DryRun && cfg.perRepo():
+		executorRun.finish = fs.personalisePullRequests(streamName, pr, cfg, templateData)
+	}
+	err = fs.runStore.Create(RunRecord{
+		ID:              streamName,
+		Kind:            kind,
+		RefreshStrategy: refreshStrategy,
+		User:            pr.User,
+		Org:             pr.Org,
+		Patch:           pr.Patch,
+		DryRun:          pr.DryRun,
+		Targets:         targets,
+		Parameters:      parameters,
+		PatchRevision:   patchRevision,
+		PatchHash:       patchHash,
+		DryRunID:        pr.DryRunID,
+		Status:          RunStatusQueued,
+		StartedAt:       time.Now(),
+	})
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	fs.runQueue.submit(&queuedRun{
+		streamName: streamName,
+		user:       pr.User,
+		org:        pr.Org,
+		start: func(done func()) {
+			fs.startRun(executorRun, func() {
+				fs.removeSnapshot(streamName)
+				done()
+			})
+		},
+	})
+	return executorRun.streamName, nil
+}
+
+// startRun hands a run whose turn has come in the queue to the executor.
+func (fs *FanoutServiceImpl) startRun(er executorRun, done func()) {
+	er.done = done
+	err := fs.runStore.Update(er.streamName, func(r *RunRecord) {
+		r.Status = RunStatusRunning
+	})
+	if err == nil {
+		err = fs.runExecutor().Run(er)
 	}
+	if err != nil {
+		fs.failRun(er.streamName, err)
+		done()
+	}
+}
+
+// StatusReport is the state of a patch's PRs across an org, along with its tracking issue.
+type StatusReport struct {
+	IssueURL     string
+	PullRequests []PullRequest
+}
+
+// Status reports on the PRs opened for a patch and creates its tracking issue. The PRs are still reported if
+// the tracking issue can't be created.
+func (fs *FanoutServiceImpl) Status(c echo.Context, pr PatchRun) (StatusReport, error) {
+	patch, err := fs.patch(pr.Patch)
+	if err != nil {
+		return StatusReport{}, err
+	}
+	if pr.RunID != "" {
+		// the tracking issue is recorded against the run, which must be one of this patch's the user can see
+		run, err := fs.visibleRun(c, pr.RunID)
+		if err != nil {
+			return StatusReport{}, err
+		}
+		if run.Org != pr.Org || run.Patch != pr.Patch {
+			return StatusReport{}, ErrRunNotFound
+		}
+	}
+	pullRequests, err := fs.githubService.PullRequests(pr.AccessToken, pr.Org, patch.cfg.Branch, patch.cfg.headOwner(pr.Org))
+	if err != nil {
+		return StatusReport{}, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	err = fs.checkPullRequests(pr.AccessToken, pullRequests)
+	if err != nil {
+		return StatusReport{}, err
+	}
+	report := StatusReport{PullRequests: pullRequests}
+	issueLink, err := fs.updateTrackingIssue(pr.AccessToken, pr.Org, patch, pullRequests)
+	if err != nil {
+		return report, err
+	}
+	report.IssueURL = issueLink
+	if pr.RunID != "" {
+		err = fs.runStore.Update(pr.RunID, func(r *RunRecord) {
+			r.IssueURL = issueLink
+		})
+		if err != nil {
+			return report, fmt.Errorf("error recording tracking issue: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// updateTrackingIssue creates a patch's tracking issue, or brings it up to date with the patch's PRs, returning
+// the issue's URL.
+func (fs *FanoutServiceImpl) updateTrackingIssue(token string, org string, patch Patch, pullRequests []PullRequest) (string, error) {
+	// merged PRs are checked off and closed ones struck through, and open ones show how their checks are doing
 	const bodyTemplate = `
 {{- range .}}
-* {{.}}
+{{- if eq .State "merged"}}
+- [x] {{.URL}}
+{{- else if eq .State "closed"}}
+- [ ] ~~{{.URL}}~~
+{{- else if eq .Checks "passing" "failing" "pending"}}
+- [ ] {{.URL}} (checks {{.Checks}})
+{{- else}}
+- [ ] {{.URL}}
+{{- end}}
 {{- end}}`
 	t, err := template.New("body").Parse(bodyTemplate)
 	if err != nil {
 		return "", err
 	}
 	var buf bytes.Buffer
-	err = t.Execute(&buf, prLinks)
+	err = t.Execute(&buf, pullRequests)
 	if err != nil {
 		return "", err
 	}
-	issueBody := buf.String()
-	issue := Issue{
-		Owner: pr.Org,
-		Title: patchCfg.PRTitle,
-		Body:  issueBody,
-	}
-	issueLink, err := fs.githubService.GetOrCreateIssue(c, issue)
+	// the title has to stay the same between runs for the issue to be found again
+	issueTitle, _, err := patch.cfg.renderPR(PRTemplateData{Owner: org, Patch: patch.Name})
 	if err != nil {
 		return "", err
 	}
-	return issueLink, nil
+	issue := Issue{
+		Owner:  org,
+		Title:  issueTitle,
+		Body:   buf.String(),
+		Closed: campaignFinished(pullRequests),
+	}
+	return fs.githubService.CreateOrUpdateIssue(token, issue)
 }
 
-func (*FanoutServiceImpl) Output(streamName string) ([]string, bool, error) {
-	ch, ok := outputMap.Load(streamName)
-	if !ok {
-		return []string{}, false, fmt.Errorf("no stream found for name %s", streamName)
+// campaignFinished reports whether every PR of a patch has been merged or closed.
+func campaignFinished(pullRequests []PullRequest) bool {
+	if len(pullRequests) == 0 {
+		return false
 	}
-	var outputLines []string
-	for {
-		select {
-		case line, ok := <-ch.(chan string):
-			if !ok {
-				outputMap.Delete(streamName)
-				return outputLines, true, nil
-			}
-			outputLines = append(outputLines, line)
-		default:
-			return outputLines, false, nil
+	for _, pr := range pullRequests {
+		if pr.State == PullRequestOpen {
+			return false
 		}
 	}
+	return true
 }
 
-func (fs *FanoutServiceImpl) runArgs(pr PatchRun) ([]string, error) {
-	cfg, err := fs.patchConfig(pr)
+// Cancel stops a run in one of the current user's orgs, or takes it off the queue if it hasn't started yet.
+func (fs *FanoutServiceImpl) Cancel(c echo.Context, streamName string) error {
+	record, err := fs.visibleRun(c, streamName)
 	if err != nil {
-		return []string{}, err
+		return fmt.Errorf("no stream found for name %s: %w", streamName, err)
 	}
-	patch := fmt.Sprintf("patches/%s/patch", pr.Patch)
-	args := []string{
-		"run",
-		patch,
-		"--token", pr.AccessToken,
-		"--org", pr.Org,
-		"--branch", cfg.Branch,
-		"--pr-title", cfg.PRTitle,
-		"--pr-body", cfg.PRBody,
-		"--plain-output",
+	if record.Done() {
+		return ErrRunNotRunning
 	}
-	if pr.DryRun {
-		args = append(args, "--log-level", "debug", "--dry-run")
+	if fs.runQueue.remove(streamName) {
+		fs.removeSnapshot(streamName)
+		err := fs.runStore.Append(streamName, ErrRunCancelled.Error())
+		if err != nil {
+			return err
+		}
+		return fs.runStore.Update(streamName, func(r *RunRecord) {
+			r.Status = RunStatusCancelled
+			r.EndedAt = time.Now()
+			r.ExitCode = -1
+		})
 	}
+	return fs.runExecutor().Cancel(streamName)
+}
 
-	return args, nil
+func (fs *FanoutServiceImpl) runExecutor() runExecutor {
+	if fs.patchRunExecutor == nil {
+		return &runExecutorImpl{runStore: fs.runStore}
+	}
+	return fs.patchRunExecutor
 }
 
-func (fs *FanoutServiceImpl) statusArgs(pr PatchRun) ([]string, error) {
-	cfg, err := fs.patchConfig(pr)
+// failRun records a run that could not be started.
+func (fs *FanoutServiceImpl) failRun(streamName string, runErr error) {
+	err := fs.runStore.Append(streamName, fmt.Sprintf("error starting run: %v", runErr))
 	if err != nil {
-		return []string{}, err
+		log.Printf("error storing output: %v", err)
 	}
-	args := []string{
-		"status",
-		"--token", pr.AccessToken,
-		"--org", pr.Org,
-		"--branch", cfg.Branch,
+	err = fs.runStore.Update(streamName, func(r *RunRecord) {
+		r.Status = RunStatusFailed
+		r.EndedAt = time.Now()
+		r.ExitCode = -1
+	})
+	if err != nil {
+		log.Printf("error recording run result: %v", err)
 	}
+}
 
-	return args, nil
+// RunOutput is the output of a run read from a cursor onwards.
+type RunOutput struct {
+	Lines  []string
+	Cursor int // where the next read continues from
+	Run    RunRecord
 }
 
-func (fs *FanoutServiceImpl) patchConfig(pr PatchRun) (config, error) {
-	patchesRoot, err := os.OpenRoot(patchDir)
+// Output reads a run's output from cursor onwards; any number of viewers can follow the same run.
+func (fs *FanoutServiceImpl) Output(streamName string, cursor int) (RunOutput, error) {
+	// the record must be read before the output so that a run finishing in between isn't reported
+	// as done without all of its lines
+	record, err := fs.runStore.Get(streamName)
 	if err != nil {
-		return config{}, err
+		return RunOutput{}, fmt.Errorf("no stream found for name %s: %w", streamName, err)
 	}
-	patchRoot, err := patchesRoot.OpenRoot(pr.Patch)
+	lines, next, err := fs.runStore.read(streamName, cursor)
 	if err != nil {
-		return config{}, err
+		return RunOutput{}, err
+	}
+	if record.Status == RunStatusQueued {
+		record.QueuePosition = fs.runQueue.position(streamName)
 	}
-	cfgData, err := patchRoot.ReadFile("config.yml")
+	return RunOutput{Lines: lines, Cursor: next, Run: record}, nil
+}
+
+// streamHeartbeat is how often a stream is sent an update while its run produces no output.
+const streamHeartbeat = 5 * time.Second
+
+// Stream sends the output of a run in one of the current user's orgs from cursor onwards as it's produced, and
+// returns once the last of it has been sent or the request is done.
+func (fs *FanoutServiceImpl) Stream(c echo.Context, streamName string, cursor int, send func(RunOutput) error) error {
+	_, err := fs.visibleRun(c, streamName)
+	if err != nil {
+		return fmt.Errorf("no stream found for name %s: %w", streamName, err)
+	}
+	ctx := c.Request().Context()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		record, err := fs.runStore.Get(streamName)
+		if err != nil {
+			return fmt.Errorf("no stream found for name %s: %w", streamName, err)
+		}
+		l, ok := fs.runStore.live(streamName)
+		if !ok {
+			break
+		}
+		lines, next, done, changed := l.read(cursor)
+		if done {
+			// the record has its final state by the time the log is closed
+			break
+		}
+		if record.Status == RunStatusQueued {
+			record.QueuePosition = fs.runQueue.position(streamName)
+		}
+		if err := send(RunOutput{Lines: lines, Cursor: next, Run: record}); err != nil {
+			return err
+		}
+		cursor = next
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	// the final update carries the whole output so that viewers can render the complete run
+	out, err := fs.Output(streamName, 0)
+	if err != nil {
+		return err
+	}
+	return send(out)
+}
+
+// History lists past runs in the orgs visible to the current user, optionally filtered by org and patch.
+func (fs *FanoutServiceImpl) History(c echo.Context, org string, patch string) ([]RunRecord, error) {
+	orgs, err := fs.Orgs(c)
+	if err != nil {
+		return []RunRecord{}, err
+	}
+	return fs.history(orgs, org, patch)
+}
+
+// history lists past runs in orgs, the orgs visible to the current user, optionally filtered by org and patch.
+func (fs *FanoutServiceImpl) history(orgs []string, org string, patch string) ([]RunRecord, error) {
+	records, err := fs.runStore.List()
+	if err != nil {
+		return []RunRecord{}, fmt.Errorf("error listing runs: %w", err)
+	}
+	var history []RunRecord
+	for _, r := range records {
+		if !slices.Contains(orgs, r.Org) {
+			continue
+		}
+		if (org != "" && r.Org != org) || (patch != "" && r.Patch != patch) {
+			continue
+		}
+		history = append(history, r)
+	}
+	return history, nil
+}
+
+// Replay returns a past run along with its full captured output.
+func (fs *FanoutServiceImpl) Replay(c echo.Context, id string) (RunRecord, []string, error) {
+	record, err := fs.visibleRun(c, id)
 	if err != nil {
-		return config{}, err
+		return RunRecord{}, []string{}, err
 	}
-	var cfg config
-	err = yaml.Unmarshal(cfgData, &cfg)
+	lines, err := fs.runStore.Output(id)
 	if err != nil {
-		return config{}, err
+		return RunRecord{}, []string{}, err
 	}
-	return cfg, nil
+	return record, lines, nil
+}
+
+// visibleRun gets a run, as long as it's in one of the current user's orgs; other runs aren't found, the same as
+// runs that don't exist.
+func (fs *FanoutServiceImpl) visibleRun(c echo.Context, id string) (RunRecord, error) {
+	orgs, err := fs.Orgs(c)
+	if err != nil {
+		return RunRecord{}, err
+	}
+	record, err := fs.runStore.Get(id)
+	if err != nil {
+		return RunRecord{}, err
+	}
+	if !slices.Contains(orgs, record.Org) {
+		return RunRecord{}, ErrRunNotFound
+	}
+	return record, nil
+}
+
+// runArgs runs the patch in snapshot, the run's copy of it.
+func (fs *FanoutServiceImpl) runArgs(pr PatchRun, snapshot string, cfg config, targetArgs []string) []string {
+	patch := filepath.Join(snapshot, pr.Patch, "patch")
+	args := []string{
+		"run",
+		patch,
+		"--token", pr.AccessToken,
+	}
+	args = append(args, targetArgs...)
+	args = append(args,
+		"--branch", cfg.Branch,
+		"--pr-title", cfg.PRTitle,
+		"--pr-body", cfg.PRBody,
+	)
+	args = append(args, cfg.args()...)
+	args = append(args, "--plain-output")
+	if pr.DryRun {
+		args = append(args, "--log-level", "debug", "--dry-run")
+	}
+
+	return args
 }
@@ -1,29 +1,35 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
-var capturedArgs []string
+var (
+	capturedArgs []string
+	capturedEnv  []string
+)
 
 type mockRunExecutor struct{}
 
 func (*mockRunExecutor) Run(er executorRun) error {
 	capturedArgs = er.args
+	capturedEnv = er.env
 	return nil
 }
 
-type mockStatusExecutor struct{}
-
-func (*mockStatusExecutor) Status(er executorStatus) ([]string, error) {
-	capturedArgs = er.args
-	return []string{"issue 1", "issue 2"}, nil
+func (*mockRunExecutor) Cancel(streamName string) error {
+	return nil
 }
 
 func chdir(t *testing.T, dir string) func() {
@@ -41,12 +47,27 @@ func chdir(t *testing.T, dir string) func() {
 	}
 }
 
-func NewMockFanoutService() FanoutService {
+func NewMockFanoutService(t *testing.T) FanoutService {
+	runStore, err := NewFileRunStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating run store: %v", err)
+	}
 	return &FanoutServiceImpl{
-		githubService:       &mockGitHubService{},
-		patchRunExecutor:    &mockRunExecutor{},
-		patchStatusExecutor: &mockStatusExecutor{},
+		githubService:    &mockGitHubService{},
+		runStore:         newLiveRunStore(runStore),
+		runQueue:         newRunQueue(0, 0),
+		patchRunExecutor: &mockRunExecutor{},
+		snapshots:        t.TempDir(),
+	}
+}
+
+// dryRun dry runs a patch in gh-org, returning the ID of the dry run for a real run to follow up on.
+func dryRun(t *testing.T, fs FanoutService, patch string) string {
+	id, err := fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: patch, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry running %s: %v", patch, err)
 	}
+	return id
 }
 
 type mockGitHubService struct {
@@ -59,23 +80,131 @@ func (*mockGitHubService) AccessToken(c echo.Context) (string, error) {
 	return "access-token", nil
 }
 
+func (*mockGitHubService) User(c echo.Context) (string, error) {
+	return "octocat", nil
+}
+
+// orgsCalls counts the org membership lookups, which are calls to GitHub in the real service.
+var orgsCalls int
+
 func (*mockGitHubService) Orgs(c echo.Context) ([]string, error) {
+	orgsCalls++
 	orgs := []string{"howdy", "there"}
 	return orgs, nil
 }
 
+func (*mockGitHubService) Repos(c echo.Context, org string) ([]string, error) {
+	return []string{"api", "web", "web-legacy"}, nil
+}
+
+func (*mockGitHubService) DefaultBranch(token string, repo string) (string, error) {
+	return "main", nil
+}
+
+type pullRequestEdit struct {
+	repo   string
+	number int
+	title  string
+	body   string
+}
+
+var capturedEdits []pullRequestEdit
+
+func (*mockGitHubService) EditPullRequest(token string, repo string, number int, title string, body string) error {
+	capturedEdits = append(capturedEdits, pullRequestEdit{repo, number, title, body})
+	return nil
+}
+
+type pullRequestMerge struct {
+	repo   string
+	number int
+	method MergeMethod
+}
+
+var capturedMerges []pullRequestMerge
+
+func (*mockGitHubService) MergePullRequest(token string, repo string, number int, method MergeMethod) error {
+	if repo == "gh-org/unmergeable" {
+		return errors.New("base branch was modified")
+	}
+	capturedMerges = append(capturedMerges, pullRequestMerge{repo, number, method})
+	return nil
+}
+
+var capturedWithdrawals []string
+
+func (*mockGitHubService) CommentOnPullRequest(token string, repo string, number int, body string) error {
+	capturedWithdrawals = append(capturedWithdrawals, fmt.Sprintf("comment on %s #%d: %s", repo, number, body))
+	return nil
+}
+
+func (*mockGitHubService) ClosePullRequest(token string, repo string, number int) error {
+	if repo == "gh-org/unclosable" {
+		return errors.New("resource not accessible by integration")
+	}
+	capturedWithdrawals = append(capturedWithdrawals, fmt.Sprintf("close %s #%d", repo, number))
+	return nil
+}
+
+func (*mockGitHubService) DeleteBranch(token string, repo string, branch string) error {
+	capturedWithdrawals = append(capturedWithdrawals, fmt.Sprintf("delete %s %s", repo, branch))
+	return nil
+}
+
+func (*mockGitHubService) RebasePullRequestBranch(token string, repo string, number int) (bool, error) {
+	switch repo {
+	case "gh-org/current":
+		return false, nil
+	case "gh-org/conflicted":
+		return false, fmt.Errorf("%w: rebase conflict between base and head", ErrBranchConflict)
+	}
+	return true, nil
+}
+
+// mockTrees gives the tree of each commit the mock knows of; commits missing from it have trees of their own.
+var mockTrees = map[string]string{}
+
+func (*mockGitHubService) TreeSHA(token string, repo string, sha string) (string, error) {
+	if tree, ok := mockTrees[sha]; ok {
+		return tree, nil
+	}
+	return "tree of " + sha, nil
+}
+
+func (*mockGitHubService) Checks(token string, repo string, sha string) (CheckState, error) {
+	if sha == "" {
+		return CheckStateNone, nil
+	}
+	return CheckStateFailing, nil
+}
+
 var capturedIssue Issue
 
-func (*mockGitHubService) GetOrCreateIssue(c echo.Context, i Issue) (string, error) {
+var mockPullRequests = []PullRequest{
+	{Repo: "gh-org/repo-1", Number: 1, URL: "pr 1", State: PullRequestOpen, ReviewState: ReviewStateNone},
+	{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestMerged, ReviewState: ReviewStateApproved},
+}
+
+func (*mockGitHubService) PullRequests(token string, org string, branch string, headOwner string) ([]PullRequest, error) {
+	capturedArgs = []string{org, branch, headOwner}
+	return slices.Clone(mockPullRequests), nil
+}
+
+func (*mockGitHubService) CreateOrUpdateIssue(token string, i Issue) (string, error) {
 	capturedIssue = i
 	return "issue link", nil
 }
 
+func newContext() echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/run", nil)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
 func TestStatus(t *testing.T) {
 	defer chdir(t, "..")()
 	capturedArgs = []string{} // reset arg capture
 	capturedIssue = Issue{}   // reset issue capture
-	fs := NewMockFanoutService()
+	fs := NewMockFanoutService(t)
 	pr := PatchRun{
 		AccessToken: "gh-api-token",
 		Org:         "gh-org",
@@ -85,37 +214,66 @@ func TestStatus(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/status", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
-	_, err := fs.Status(c, pr)
-	expectedArgs := []string{ // see patches/example/config.yml
-		"status",
-		"--token", "gh-api-token",
-		"--org", "gh-org",
-		"--branch", "example-patch-pr-branch",
-	}
+	report, err := fs.Status(c, pr)
+	expectedArgs := []string{"gh-org", "example-patch-pr-branch", "gh-org"} // see patches/example/config.yml
 	assert.Nil(t, err, "Expected nil error, got %v", err)
 	assert.Equal(t, expectedArgs, capturedArgs, "Expected %v to be %v", capturedArgs, expectedArgs)
+	assert.Equal(t, "issue link", report.IssueURL)
+	assert.Equal(t, CheckStateNone, report.PullRequests[0].Checks)
+	assert.Empty(t, report.PullRequests[1].Checks, "Expected the checks of merged PRs not to be fetched")
 	expectedIssue := Issue{
 		Owner: "gh-org",
 		Title: "Example PR Title",
-		Body:  "\n* issue 1\n* issue 2",
+		Body:  "\n- [ ] pr 1\n- [x] pr 2",
 	}
 	assert.Equal(t, expectedIssue, capturedIssue, "Expected %v to be %v", capturedIssue, expectedIssue)
 }
 
+func TestStatusRecordsIssueOnRun(t *testing.T) {
+	defer chdir(t, "..")()
+	fs := NewMockFanoutService(t)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	for _, record := range []RunRecord{
+		{ID: "visible", Org: "howdy", Patch: "example", Status: RunStatusSucceeded},
+		{ID: "other-patch", Org: "howdy", Patch: "other", Status: RunStatusSucceeded},
+		{ID: "hidden", Org: "hidden", Patch: "example", Status: RunStatusSucceeded},
+	} {
+		if err := runStore.Create(record); err != nil {
+			t.Fatalf("creating run: %v", err)
+		}
+	}
+	_, err := fs.Status(newContext(), PatchRun{Org: "howdy", Patch: "example", RunID: "visible"})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record, err := runStore.Get("visible")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, "issue link", record.IssueURL)
+
+	for _, id := range []string{"other-patch", "hidden"} {
+		_, err = fs.Status(newContext(), PatchRun{Org: "howdy", Patch: "example", RunID: id})
+		assert.ErrorIs(t, err, ErrRunNotFound)
+		record, err = runStore.Get(id)
+		assert.Nil(t, err, "Expected nil error, got %v", err)
+		assert.Empty(t, record.IssueURL, "Expected run %s to be left alone", id)
+	}
+}
+
 func TestRun(t *testing.T) {
 	defer chdir(t, "..")()
 	capturedArgs = []string{} // reset arg capture
-	fs := NewMockFanoutService()
+	fs := NewMockFanoutService(t)
 	pr := PatchRun{
 		AccessToken: "gh-api-token",
+		User:        "octocat",
 		Org:         "gh-org",
 		Patch:       "example",
 		DryRun:      false,
+		DryRunID:    dryRun(t, fs, "example"),
 	}
-	_, err := fs.Run(pr)
+	streamName, err := fs.Run(newContext(), pr)
+	snapshots := fs.(*FanoutServiceImpl).snapshots
 	expectedArgs := []string{ // see patches/example/config.yml
 		"run",
-		"patches/example/patch",
+		filepath.Join(snapshots, streamName, "example", "patch"),
 		"--token", "gh-api-token",
 		"--org", "gh-org",
 		"--branch", "example-patch-pr-branch",
@@ -125,22 +283,27 @@ func TestRun(t *testing.T) {
 	}
 	assert.Nil(t, err, "Expected nil error, got %v", err)
 	assert.Equal(t, expectedArgs, capturedArgs, "Expected %v to be %v", capturedArgs, expectedArgs)
+	record, err := fs.(*FanoutServiceImpl).runStore.Get(streamName)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, "octocat", record.User)
+	assert.Equal(t, RunStatusRunning, record.Status)
 }
 
 func TestDryRun(t *testing.T) {
 	defer chdir(t, "..")()
 	capturedArgs = []string{} // reset arg capture
-	fs := NewMockFanoutService()
+	fs := NewMockFanoutService(t)
 	pr := PatchRun{
 		AccessToken: "gh-api-token",
 		Org:         "gh-org",
 		Patch:       "example",
 		DryRun:      true,
 	}
-	_, err := fs.Run(pr)
+	streamName, err := fs.Run(newContext(), pr)
+	snapshots := fs.(*FanoutServiceImpl).snapshots
 	expectedArgs := []string{ // see patches/example/config.yml
 		"run",
-		"patches/example/patch",
+		filepath.Join(snapshots, streamName, "example", "patch"),
 		"--token", "gh-api-token",
 		"--org", "gh-org",
 		"--branch", "example-patch-pr-branch",
@@ -154,18 +317,198 @@ func TestDryRun(t *testing.T) {
 	assert.Equal(t, expectedArgs, capturedArgs, "Expected %v to be %v", capturedArgs, expectedArgs)
 }
 
+func TestRunSelectedRepos(t *testing.T) {
+	defer chdir(t, "..")()
+	capturedArgs = []string{} // reset arg capture
+	fs := NewMockFanoutService(t)
+	pr := PatchRun{
+		AccessToken: "gh-api-token",
+		Org:         "gh-org",
+		Patch:       "example",
+		Targets:     Targets{Topics: []string{"go"}},
+		SelectRepos: true,
+		Selected:    []string{"gh-org/api", "gh-org/web"},
+		DryRunID:    dryRun(t, fs, "example"),
+	}
+	streamName, err := fs.Run(newContext(), pr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"--repo", "gh-org/api", "--repo", "gh-org/web"}, capturedArgs[4:8])
+	record, err := fs.(*FanoutServiceImpl).runStore.Get(streamName)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, Targets{Repos: pr.Selected}, record.Targets)
+
+	pr.Selected = nil
+	_, err = fs.Run(newContext(), pr)
+	assert.ErrorIs(t, err, ErrNoReposSelected)
+}
+
 func TestInvalidPatchName(t *testing.T) {
 	defer chdir(t, "..")()
 	capturedArgs = []string{} // reset arg capture
-	fs := NewMockFanoutService()
+	fs := NewMockFanoutService(t)
 	pr := PatchRun{
 		AccessToken: "gh-api-token",
 		Org:         "gh-org",
 		Patch:       "../../invalid-patch",
 		DryRun:      true,
 	}
-	_, err := fs.Run(pr)
+	_, err := fs.Run(newContext(), pr)
 	assert.NotNil(t, err, "Expected error got nil")
 	expectedError := "invalid patch name: ../../invalid-patch"
 	assert.Equal(t, expectedError, err.Error())
 }
+
+func TestHistory(t *testing.T) {
+	fs := NewMockFanoutService(t)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	started := time.Now()
+	for i, r := range []RunRecord{
+		{ID: "howdy-example", Org: "howdy", Patch: "example"},
+		{ID: "howdy-other", Org: "howdy", Patch: "other"},
+		{ID: "hidden-example", Org: "hidden", Patch: "example"}, // not one of the user's orgs
+	} {
+		r.Status = RunStatusSucceeded
+		r.StartedAt = started.Add(time.Duration(i) * time.Second)
+		if err := runStore.Create(r); err != nil {
+			t.Fatalf("creating run: %v", err)
+		}
+	}
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/history", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	history, err := fs.History(c, "", "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "howdy-example", history[0].ID)
+	}
+	_, _, err = fs.Replay(c, "hidden-example")
+	assert.ErrorIs(t, err, ErrRunNotFound)
+}
+
+// writePatch creates a patch with the given config.yml in dir.
+func writePatch(t *testing.T, dir string, name string, cfg string) {
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatalf("creating patch: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "config.yml"), []byte(cfg), 0o644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "patch"), []byte("#!/usr/bin/env bash\n"), 0o755); err != nil {
+		t.Fatalf("writing patch: %v", err)
+	}
+}
+
+// fakeMultiGitter puts a multi-gitter stand-in running script on the PATH.
+func fakeMultiGitter(t *testing.T, script string) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "multi-gitter"), []byte("#!/usr/bin/env bash\n"+script), 0o755)
+	if err != nil {
+		t.Fatalf("writing fake multi-gitter: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func waitForRun(t *testing.T, runStore RunStore, id string) RunRecord {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		record, err := runStore.Get(id)
+		if err != nil {
+			t.Fatalf("getting run: %v", err)
+		}
+		if record.Done() {
+			return record
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("run %s did not finish", id)
+	return RunRecord{}
+}
+
+func TestRunExecutorCancel(t *testing.T) {
+	fakeMultiGitter(t, "echo started\nsleep 60 &\nwait\n")
+	runStore, err := NewFileRunStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating run store: %v", err)
+	}
+	if err := runStore.Create(RunRecord{ID: "run", Status: RunStatusRunning}); err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	ex := &runExecutorImpl{runStore: runStore}
+	err = ex.Run(executorRun{streamName: "run"})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Eventually(t, func() bool {
+		lines, _ := runStore.Output("run")
+		return len(lines) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, ex.Cancel("run"))
+	record := waitForRun(t, runStore, "run")
+	assert.Equal(t, RunStatusCancelled, record.Status)
+	lines, err := runStore.Output("run")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"started", "run cancelled"}, lines)
+	assert.ErrorIs(t, ex.Cancel("run"), ErrRunNotRunning)
+}
+
+func TestCancel(t *testing.T) {
+	fs := NewMockFanoutService(t)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	for _, r := range []RunRecord{
+		{ID: "howdy-run", Org: "howdy", Status: RunStatusRunning},
+		{ID: "hidden-run", Org: "hidden", Status: RunStatusRunning}, // not one of the user's orgs
+	} {
+		if err := runStore.Create(r); err != nil {
+			t.Fatalf("creating run: %v", err)
+		}
+	}
+	err := fs.Cancel(newContext(), "howdy-run")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	err = fs.Cancel(newContext(), "hidden-run")
+	assert.ErrorIs(t, err, ErrRunNotFound)
+}
+
+func TestRunExecutorTimeout(t *testing.T) {
+	fakeMultiGitter(t, "echo started\nsleep 60\n")
+	runStore, err := NewFileRunStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating run store: %v", err)
+	}
+	if err := runStore.Create(RunRecord{ID: "run", Status: RunStatusRunning}); err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	ex := &runExecutorImpl{runStore: runStore}
+	err = ex.Run(executorRun{streamName: "run", timeout: 100 * time.Millisecond})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record := waitForRun(t, runStore, "run")
+	assert.Equal(t, RunStatusTimedOut, record.Status)
+	lines, err := runStore.Output("run")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"started", "run timed out after 100ms"}, lines)
+}
+
+func TestStatusFinishedCampaign(t *testing.T) {
+	defer chdir(t, "..")()
+	capturedIssue = Issue{} // reset issue capture
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/repo-1", Number: 1, URL: "pr 1", State: PullRequestClosed},
+		{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestMerged},
+	}
+	fs := NewMockFanoutService(t)
+	pr := PatchRun{
+		AccessToken: "gh-api-token",
+		Org:         "gh-org",
+		Patch:       "example",
+	}
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	_, err := fs.Status(c, pr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, "\n- [ ] ~~pr 1~~\n- [x] pr 2", capturedIssue.Body)
+	assert.True(t, capturedIssue.Closed, "Expected the tracking issue to be closed once every PR is merged or closed")
+}
@@ -2,19 +2,41 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/google/go-github/v74/github"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
 )
 
+// githubConcurrency is how many calls to GitHub are made at once when fetching the details of many PRs.
+const githubConcurrency = 8
+
 type GitHubService interface {
 	ClearSession(c echo.Context)
+	User(c echo.Context) (string, error)
 	Orgs(c echo.Context) ([]string, error)
-	GetOrCreateIssue(c echo.Context, i Issue) (string, error)
+	Repos(c echo.Context, org string) ([]string, error)
 	AccessToken(c echo.Context) (string, error)
+	// runs outlive the session that launched them, so work done on a run's behalf authenticates with its token
+	CreateOrUpdateIssue(token string, i Issue) (string, error)
+	PullRequests(token string, org string, branch string, headOwner string) ([]PullRequest, error)
+	DefaultBranch(token string, repo string) (string, error)
+	EditPullRequest(token string, repo string, number int, title string, body string) error
+	MergePullRequest(token string, repo string, number int, method MergeMethod) error
+	CommentOnPullRequest(token string, repo string, number int, body string) error
+	ClosePullRequest(token string, repo string, number int) error
+	DeleteBranch(token string, repo string, branch string) error
+	RebasePullRequestBranch(token string, repo string, number int) (bool, error)
+	TreeSHA(token string, repo string, sha string) (string, error)
+	Checks(token string, repo string, sha string) (CheckState, error)
 }
 
 func NewGitHubService(oauthService *OAuthService) *GitHubAPIService {
@@ -39,6 +61,19 @@ func (gs *GitHubAPIService) AccessToken(c echo.Context) (string, error) {
 	return token, nil
 }
 
+func (gs *GitHubAPIService) User(c echo.Context) (string, error) {
+	ctx := context.Background()
+	client, err := gs.oauthService.Client(c)
+	if err != nil {
+		return "", fmt.Errorf("error getting client: %w", err)
+	}
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting user: %w", err)
+	}
+	return user.GetLogin(), nil
+}
+
 func (gs *GitHubAPIService) Orgs(c echo.Context) ([]string, error) {
 	ctx := context.Background()
 	client, err := gs.oauthService.Client(c)
@@ -65,23 +100,50 @@ func (gs *GitHubAPIService) Orgs(c echo.Context) ([]string, error) {
 	return allOrgs, nil
 }
 
+// Repos lists the names of an org's repositories
+func (gs *GitHubAPIService) Repos(c echo.Context, org string) ([]string, error) {
+	ctx := context.Background()
+	client, err := gs.oauthService.Client(c)
+	if err != nil {
+		return []string{}, fmt.Errorf("error getting client: %w", err)
+	}
+	opt := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	var allRepos []string
+	for {
+		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
+		if err != nil {
+			return []string{}, fmt.Errorf("error listing repos: %w", err)
+		}
+		for _, repo := range repos {
+			allRepos = append(allRepos, repo.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return allRepos, nil
+}
+
 type Issue struct {
-	Owner string
-	Body  string
-	Title string
+	Owner  string
+	Body   string
+	Title  string
+	Closed bool
 }
 
 const fanoutRepo = "fan-out"
 
 var ErrRepoMissing = fmt.Errorf("%s must exist as a repository in your target organization", fanoutRepo)
 
-// Gets or creates a GitHub issue
-func (gs *GitHubAPIService) GetOrCreateIssue(c echo.Context, i Issue) (string, error) {
+// Creates a GitHub issue, or brings the body and state of an existing issue with the same title up to date
+func (gs *GitHubAPIService) CreateOrUpdateIssue(token string, i Issue) (string, error) {
 	ctx := context.Background()
-	client, err := gs.oauthService.Client(c)
-	if err != nil {
-		return "", fmt.Errorf("error getting client: %w", err)
-	}
+	client := github.NewClient(nil).WithAuthToken(token)
 	_, resp, err := client.Repositories.Get(ctx, i.Owner, fanoutRepo)
 	if err != nil {
 		if resp.StatusCode == http.StatusNotFound {
@@ -91,6 +153,7 @@ func (gs *GitHubAPIService) GetOrCreateIssue(c echo.Context, i Issue) (string, e
 		}
 	}
 	opt := &github.IssueListByRepoOptions{
+		State: "all",
 		ListOptions: github.ListOptions{
 			PerPage: 100,
 		},
@@ -107,10 +170,25 @@ func (gs *GitHubAPIService) GetOrCreateIssue(c echo.Context, i Issue) (string, e
 		}
 		opt.ListOptions.Page = resp.NextPage
 	}
+	state := "open"
+	if i.Closed {
+		state = "closed"
+	}
 	for _, issue := range allIssues {
-		if issue.GetTitle() == i.Title {
+		if issue.IsPullRequest() || issue.GetTitle() != i.Title {
+			continue
+		}
+		if issue.GetBody() == i.Body && issue.GetState() == state {
 			return issue.GetHTMLURL(), nil
 		}
+		_, _, err := client.Issues.Edit(ctx, i.Owner, fanoutRepo, issue.GetNumber(), &github.IssueRequest{
+			Body:  &i.Body,
+			State: &state,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error updating issue: %w", err)
+		}
+		return issue.GetHTMLURL(), nil
 	}
 	issue, resp, err := client.Issues.Create(ctx, i.Owner, fanoutRepo, &github.IssueRequest{
 		Title: &i.Title,
@@ -127,5 +205,385 @@ func (gs *GitHubAPIService) GetOrCreateIssue(c echo.Context, i Issue) (string, e
 		}
 		return "", fmt.Errorf("error creating issue: %s", errorBody)
 	}
+	if i.Closed {
+		_, _, err := client.Issues.Edit(ctx, i.Owner, fanoutRepo, issue.GetNumber(), &github.IssueRequest{
+			State: &state,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error closing issue: %w", err)
+		}
+	}
 	return issue.GetHTMLURL(), nil
 }
+
+// Gets the default branch of a repository, given by its full name
+func (gs *GitHubAPIService) DefaultBranch(token string, repo string) (string, error) {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	r, _, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return "", fmt.Errorf("error getting repo: %w", err)
+	}
+	return r.GetDefaultBranch(), nil
+}
+
+// Sets the title and body of a PR
+func (gs *GitHubAPIService) EditPullRequest(token string, repo string, number int, title string, body string) error {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	_, _, err := client.PullRequests.Edit(ctx, owner, name, number, &github.PullRequest{
+		Title: &title,
+		Body:  &body,
+	})
+	if err != nil {
+		return fmt.Errorf("error editing pull request: %w", err)
+	}
+	return nil
+}
+
+// Merges a PR with the given method
+func (gs *GitHubAPIService) MergePullRequest(token string, repo string, number int, method MergeMethod) error {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	result, _, err := client.PullRequests.Merge(ctx, owner, name, number, "", &github.PullRequestOptions{
+		MergeMethod: string(method),
+	})
+	if err != nil {
+		return fmt.Errorf("error merging pull request: %w", err)
+	}
+	if !result.GetMerged() {
+		return fmt.Errorf("error merging pull request: %s", result.GetMessage())
+	}
+	return nil
+}
+
+// Comments on a PR
+func (gs *GitHubAPIService) CommentOnPullRequest(token string, repo string, number int, body string) error {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	_, _, err := client.Issues.CreateComment(ctx, owner, name, number, &github.IssueComment{
+		Body: &body,
+	})
+	if err != nil {
+		return fmt.Errorf("error commenting on pull request: %w", err)
+	}
+	return nil
+}
+
+// Closes a PR without merging it
+func (gs *GitHubAPIService) ClosePullRequest(token string, repo string, number int) error {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	state := "closed"
+	_, _, err := client.PullRequests.Edit(ctx, owner, name, number, &github.PullRequest{
+		State: &state,
+	})
+	if err != nil {
+		return fmt.Errorf("error closing pull request: %w", err)
+	}
+	return nil
+}
+
+// Deletes a branch of a repository
+func (gs *GitHubAPIService) DeleteBranch(token string, repo string, branch string) error {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	_, err := client.Git.DeleteRef(ctx, owner, name, "heads/"+branch)
+	if err != nil {
+		return fmt.Errorf("error deleting branch: %w", err)
+	}
+	return nil
+}
+
+var ErrBranchConflict = errors.New("the branch conflicts with its base branch")
+
+// rebaseMutation rebases a PR's branch, which the REST API can't: its update-branch endpoint only merges.
+const rebaseMutation = `mutation($id: ID!, $head: GitObjectID) {
+  updatePullRequestBranch(input: {pullRequestId: $id, expectedHeadOid: $head, updateMethod: REBASE}) {
+    pullRequest { id }
+  }
+}`
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// Rebases a PR's branch onto its base branch, reporting whether the branch was behind
+func (gs *GitHubAPIService) RebasePullRequestBranch(token string, repo string, number int) (bool, error) {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	pr, _, err := client.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return false, fmt.Errorf("error getting pull request: %w", err)
+	}
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, name, pr.GetBase().GetRef(), pr.GetHead().GetSHA(), nil)
+	if err != nil {
+		return false, fmt.Errorf("error comparing branches: %w", err)
+	}
+	if comparison.GetBehindBy() == 0 {
+		return false, nil
+	}
+	if pr.GetMergeableState() == "dirty" {
+		return false, ErrBranchConflict
+	}
+	req, err := client.NewRequest(http.MethodPost, "graphql", graphQLRequest{
+		Query: rebaseMutation,
+		Variables: map[string]any{
+			"id": pr.GetNodeID(),
+			// don't clobber anything pushed since the PR was read
+			"head": pr.GetHead().GetSHA(),
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error rebasing branch: %w", err)
+	}
+	var resp graphQLResponse
+	_, err = client.Do(ctx, req, &resp)
+	if err != nil {
+		return false, fmt.Errorf("error rebasing branch: %w", err)
+	}
+	for _, e := range resp.Errors {
+		// GitHub refuses a rebase that doesn't apply cleanly as unprocessable
+		if e.Type == "UNPROCESSABLE" {
+			return false, fmt.Errorf("%w: %s", ErrBranchConflict, e.Message)
+		}
+		return false, fmt.Errorf("error rebasing branch: %s", e.Message)
+	}
+	return true, nil
+}
+
+// Gets the SHA of a commit's tree, which commits with the same content share
+func (gs *GitHubAPIService) TreeSHA(token string, repo string, sha string) (string, error) {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	commit, _, err := client.Git.GetCommit(ctx, owner, name, sha)
+	if err != nil {
+		return "", fmt.Errorf("error getting commit: %w", err)
+	}
+	return commit.GetTree().GetSHA(), nil
+}
+
+type PullRequestState string
+
+const (
+	PullRequestOpen   PullRequestState = "open"
+	PullRequestMerged PullRequestState = "merged"
+	PullRequestClosed PullRequestState = "closed"
+)
+
+type ReviewState string
+
+const (
+	ReviewStateNone             ReviewState = "no reviews"
+	ReviewStateCommented        ReviewState = "commented"
+	ReviewStateApproved         ReviewState = "approved"
+	ReviewStateChangesRequested ReviewState = "changes requested"
+)
+
+type PullRequest struct {
+	Repo        string // full name, e.g. org/repo
+	Number      int
+	URL         string
+	State       PullRequestState
+	Draft       bool
+	ReviewState ReviewState
+	// MergeableState is GitHub's mergeable_state, e.g. clean when checks have passed and there are no conflicts
+	MergeableState string
+	HeadRepo       string // full name of the repository the PR's branch is in, a fork for PRs from forks
+	HeadSHA        string
+	Checks         CheckState // only filled in for the open PRs of a status report
+}
+
+// Lists the PRs opened from a branch across an org's repositories, where the branch belongs to headOwner
+func (gs *GitHubAPIService) PullRequests(token string, org string, branch string, headOwner string) ([]PullRequest, error) {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	query := fmt.Sprintf("is:pr org:%s head:%s", org, branch)
+	opt := &github.SearchOptions{
+		Sort:  "created",
+		Order: "asc",
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	var allIssues []*github.Issue
+	for {
+		result, resp, err := client.Search.Issues(ctx, query, opt)
+		if err != nil {
+			return []PullRequest{}, fmt.Errorf("error searching pull requests: %w", err)
+		}
+		allIssues = append(allIssues, result.Issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.ListOptions.Page = resp.NextPage
+	}
+	// each PR takes a couple of calls of its own, which would add up to too long for a request one at a time
+	found := make([]*PullRequest, len(allIssues))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(githubConcurrency)
+	for i, issue := range allIssues {
+		g.Go(func() error {
+			owner, repo, err := repoFromURL(issue.GetRepositoryURL())
+			if err != nil {
+				return err
+			}
+			pr, _, err := client.PullRequests.Get(ctx, owner, repo, issue.GetNumber())
+			if err != nil {
+				return fmt.Errorf("error getting pull request: %w", err)
+			}
+			// head: matches branches by prefix, and PRs from anyone else's forks aren't ours
+			if pr.GetHead().GetRef() != branch || !strings.EqualFold(pr.GetHead().GetRepo().GetOwner().GetLogin(), headOwner) {
+				return nil
+			}
+			reviewState, err := gs.reviewState(ctx, client, owner, repo, pr.GetNumber())
+			if err != nil {
+				return err
+			}
+			found[i] = &PullRequest{
+				Repo:           owner + "/" + repo,
+				Number:         pr.GetNumber(),
+				URL:            pr.GetHTMLURL(),
+				State:          pullRequestState(pr),
+				Draft:          pr.GetDraft(),
+				ReviewState:    reviewState,
+				MergeableState: pr.GetMergeableState(),
+				HeadRepo:       pr.GetHead().GetRepo().GetFullName(),
+				HeadSHA:        pr.GetHead().GetSHA(),
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return []PullRequest{}, err
+	}
+	var pullRequests []PullRequest
+	for _, pr := range found {
+		if pr != nil {
+			pullRequests = append(pullRequests, *pr)
+		}
+	}
+	return pullRequests, nil
+}
+
+// Sums up the commit statuses and check runs of a commit
+func (gs *GitHubAPIService) Checks(token string, repo string, sha string) (CheckState, error) {
+	ctx := context.Background()
+	client := github.NewClient(nil).WithAuthToken(token)
+	owner, name, _ := strings.Cut(repo, "/")
+	var states []CheckState
+	opt := &github.ListOptions{
+		PerPage: 100,
+	}
+	for {
+		combined, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, name, sha, opt)
+		if err != nil {
+			return "", fmt.Errorf("error getting commit status: %w", err)
+		}
+		for _, status := range combined.Statuses {
+			states = append(states, commitStatusState(status.GetState()))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	checkOpt := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		result, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, name, sha, checkOpt)
+		if err != nil {
+			return "", fmt.Errorf("error listing check runs: %w", err)
+		}
+		for _, run := range result.CheckRuns {
+			states = append(states, checkRunState(run.GetStatus(), run.GetConclusion()))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		checkOpt.ListOptions.Page = resp.NextPage
+	}
+	return combineCheckStates(states), nil
+}
+
+func pullRequestState(pr *github.PullRequest) PullRequestState {
+	switch {
+	case pr.GetMerged():
+		return PullRequestMerged
+	case pr.GetState() == "closed":
+		return PullRequestClosed
+	default:
+		return PullRequestOpen
+	}
+}
+
+// reviewState summarises the latest review of each reviewer: any outstanding request for changes wins over
+// approvals, which win over comments.
+func (gs *GitHubAPIService) reviewState(ctx context.Context, client *github.Client, owner string, repo string, number int) (ReviewState, error) {
+	opt := &github.ListOptions{
+		PerPage: 100,
+	}
+	latest := map[string]string{}
+	commented := false
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, number, opt)
+		if err != nil {
+			return "", fmt.Errorf("error listing reviews: %w", err)
+		}
+		for _, review := range reviews {
+			switch review.GetState() {
+			case "COMMENTED":
+				commented = true
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				latest[review.GetUser().GetLogin()] = review.GetState()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	states := slices.Collect(maps.Values(latest))
+	switch {
+	case slices.Contains(states, "CHANGES_REQUESTED"):
+		return ReviewStateChangesRequested, nil
+	case slices.Contains(states, "APPROVED"):
+		return ReviewStateApproved, nil
+	case commented || len(states) > 0:
+		return ReviewStateCommented, nil
+	default:
+		return ReviewStateNone, nil
+	}
+}
+
+// repoFromURL splits an API repository URL, e.g. https://api.github.com/repos/org/repo, into owner and name.
+func repoFromURL(repositoryURL string) (string, string, error) {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("unexpected repository url: %s", repositoryURL)
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+type MergeMethod string
+
+const (
+	MergeMethodMerge  MergeMethod = "merge"
+	MergeMethodSquash MergeMethod = "squash"
+	MergeMethodRebase MergeMethod = "rebase"
+)
+
+var (
+	ErrInvalidMergeMethod = errors.New("invalid merge method")
+	ErrNothingToMerge     = errors.New("none of the selected pull requests can be merged")
+)
+
+// MergeRun merges the PRs a patch opened across an org.
+type MergeRun struct {
+	AccessToken string
+	User        string
+	Org         string
+	Patch       string
+	Method      MergeMethod
+	Repos       []string // the repositories whose PRs were picked from the preview
+}
+
+// MergeCandidate is an open PR of a patch, along with why it can't be merged, if it can't.
+type MergeCandidate struct {
+	PullRequest
+	Reason string
+}
+
+func (mc MergeCandidate) Mergeable() bool {
+	return mc.Reason == ""
+}
+
+// mergeableStateReasons explains GitHub's mergeable states other than clean and has_hooks, which both mean
+// that checks have passed and the PR can be merged.
+var mergeableStateReasons = map[string]string{
+	"dirty":    "it has conflicts",
+	"unstable": "its checks haven't passed",
+	"blocked":  "branch protection blocks it",
+	"behind":   "it's behind its base branch",
+	"draft":    "it's a draft",
+}
+
+// mergeCandidate qualifies a PR for merging: it must be approved, and green, i.e. its checks have passed and
+// it has no conflicts.
+func mergeCandidate(pr PullRequest) MergeCandidate {
+	mc := MergeCandidate{PullRequest: pr}
+	switch {
+	case pr.Draft:
+		mc.Reason = "it's a draft"
+	case pr.ReviewState != ReviewStateApproved:
+		mc.Reason = fmt.Sprintf("it isn't approved (%s)", pr.ReviewState)
+	case pr.MergeableState == "clean" || pr.MergeableState == "has_hooks":
+	case mergeableStateReasons[pr.MergeableState] != "":
+		mc.Reason = mergeableStateReasons[pr.MergeableState]
+	default:
+		// GitHub works out whether a PR can be merged in the background after it changes
+		mc.Reason = "GitHub hasn't worked out whether it can be merged yet, try again shortly"
+	}
+	return mc
+}
+
+func validateMergeMethod(method MergeMethod) error {
+	switch method {
+	case MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+		return nil
+	}
+	return fmt.Errorf("%w %q, expected %s, %s or %s", ErrInvalidMergeMethod, method, MergeMethodMerge, MergeMethodSquash, MergeMethodRebase)
+}
+
+// MergePreview lists a patch's open PRs, saying which of them a merge would merge.
+func (fs *FanoutServiceImpl) MergePreview(c echo.Context, org string, patch string) ([]MergeCandidate, error) {
+	token, err := fs.AccessToken(c)
+	if err != nil {
+		return []MergeCandidate{}, err
+	}
+	return fs.mergeCandidates(token, org, patch)
+}
+
+func (fs *FanoutServiceImpl) mergeCandidates(token string, org string, patch string) ([]MergeCandidate, error) {
+	p, err := fs.patch(patch)
+	if err != nil {
+		return []MergeCandidate{}, err
+	}
+	pullRequests, err := fs.githubService.PullRequests(token, org, p.cfg.Branch, p.cfg.headOwner(org))
+	if err != nil {
+		return []MergeCandidate{}, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	var candidates []MergeCandidate
+	for _, pr := range pullRequests {
+		if pr.State == PullRequestOpen {
+			candidates = append(candidates, mergeCandidate(pr))
+		}
+	}
+	return candidates, nil
+}
+
+// Merge merges the PRs picked from a preview that still qualify, streaming each outcome as the output of a
+// run.
+func (fs *FanoutServiceImpl) Merge(c echo.Context, mr MergeRun) (string, error) {
+	err := validateMergeMethod(mr.Method)
+	if err != nil {
+		return "", err
+	}
+	if len(mr.Repos) == 0 {
+		return "", ErrNoReposSelected
+	}
+	// the PRs may have changed since the preview, so they're qualified again
+	candidates, err := fs.mergeCandidates(mr.AccessToken, mr.Org, mr.Patch)
+	if err != nil {
+		return "", err
+	}
+	candidates = slices.DeleteFunc(candidates, func(mc MergeCandidate) bool {
+		return !slices.Contains(mr.Repos, mc.Repo)
+	})
+	if !slices.ContainsFunc(candidates, MergeCandidate.Mergeable) {
+		return "", ErrNothingToMerge
+	}
+	reasons := map[string]string{}
+	var pullRequests []PullRequest
+	for _, mc := range candidates {
+		reasons[mc.Repo] = mc.Reason
+		pullRequests = append(pullRequests, mc.PullRequest)
+	}
+	streamName, err := fs.submitPullRequestRun(pullRequestRun{
+		record: RunRecord{
+			Kind:        RunKindMerge,
+			User:        mr.User,
+			Org:         mr.Org,
+			Patch:       mr.Patch,
+			MergeMethod: mr.Method,
+		},
+		pullRequests: pullRequests,
+		act: func(pr PullRequest) (string, *RepoResult) {
+			label := pullRequestLabel(pr)
+			if reason := reasons[pr.Repo]; reason != "" {
+				return fmt.Sprintf("skipped %s: %s", label, reason), nil
+			}
+			result := &RepoResult{Repo: pr.Repo, PRURL: pr.URL, PRNumber: pr.Number, Outcome: RepoOutcomeMerged}
+			err := fs.githubService.MergePullRequest(mr.AccessToken, pr.Repo, pr.Number, mr.Method)
+			if err != nil {
+				result.Outcome = RepoOutcomeFailed
+				result.Error = err.Error()
+				return fmt.Sprintf("failed to merge %s: %v", label, err), result
+			}
+			return "merged " + label, result
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error recording merge: %w", err)
+	}
+	return streamName, nil
+}
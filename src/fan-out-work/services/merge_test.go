@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeCandidate(t *testing.T) {
+	approved := PullRequest{State: PullRequestOpen, ReviewState: ReviewStateApproved, MergeableState: "clean"}
+	assert.True(t, mergeCandidate(approved).Mergeable())
+
+	draft := approved
+	draft.Draft = true
+	assert.Equal(t, "it's a draft", mergeCandidate(draft).Reason)
+
+	unreviewed := approved
+	unreviewed.ReviewState = ReviewStateNone
+	assert.Equal(t, "it isn't approved (no reviews)", mergeCandidate(unreviewed).Reason)
+
+	failing := approved
+	failing.MergeableState = "unstable"
+	assert.Equal(t, "its checks haven't passed", mergeCandidate(failing).Reason)
+
+	unknown := approved
+	unknown.MergeableState = "unknown"
+	assert.False(t, mergeCandidate(unknown).Mergeable())
+}
+
+func TestMerge(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/repo-1", Number: 1, URL: "pr 1", State: PullRequestOpen, ReviewState: ReviewStateApproved, MergeableState: "clean"},
+		{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestOpen, ReviewState: ReviewStateNone, MergeableState: "clean"},
+		{Repo: "gh-org/repo-3", Number: 3, URL: "pr 3", State: PullRequestMerged, ReviewState: ReviewStateApproved},
+		{Repo: "gh-org/unmergeable", Number: 4, URL: "pr 4", State: PullRequestOpen, ReviewState: ReviewStateApproved, MergeableState: "clean"},
+		{Repo: "gh-org/unpicked", Number: 5, URL: "pr 5", State: PullRequestOpen, ReviewState: ReviewStateApproved, MergeableState: "clean"},
+	}
+	capturedMerges = nil
+	fs := NewMockFanoutService(t)
+
+	preview, err := fs.MergePreview(newContext(), "gh-org", "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Len(t, preview, 4, "Expected merged PRs to be left out")
+
+	mr := MergeRun{
+		Org:    "gh-org",
+		Patch:  "example",
+		Method: MergeMethodSquash,
+		Repos:  []string{"gh-org/repo-1", "gh-org/repo-2", "gh-org/unmergeable"},
+	}
+	id, err := fs.Merge(newContext(), mr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	record := waitForRun(t, runStore, id)
+	assert.Equal(t, RunKindMerge, record.Kind)
+	assert.Equal(t, MergeMethodSquash, record.MergeMethod)
+	assert.Equal(t, RunStatusFailed, record.Status)
+	assert.Equal(t, []pullRequestMerge{{"gh-org/repo-1", 1, MergeMethodSquash}}, capturedMerges)
+	assert.Equal(t, []RepoResult{
+		{Repo: "gh-org/repo-1", Outcome: RepoOutcomeMerged, PRURL: "pr 1", PRNumber: 1},
+		{Repo: "gh-org/unmergeable", Outcome: RepoOutcomeFailed, PRURL: "pr 4", PRNumber: 4, Error: "base branch was modified"},
+	}, record.Results)
+	lines, err := runStore.Output(id)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{
+		"merged gh-org/repo-1 #1",
+		"skipped gh-org/repo-2 #2: it isn't approved (no reviews)",
+		"failed to merge gh-org/unmergeable #4: base branch was modified",
+	}, lines)
+}
+
+func TestMergeNothing(t *testing.T) {
+	defer chdir(t, "..")()
+	fs := NewMockFanoutService(t)
+	_, err := fs.Merge(newContext(), MergeRun{Org: "gh-org", Patch: "example", Method: "fast-forward", Repos: []string{"gh-org/repo-1"}})
+	assert.ErrorIs(t, err, ErrInvalidMergeMethod)
+	_, err = fs.Merge(newContext(), MergeRun{Org: "gh-org", Patch: "example", Method: MergeMethodMerge})
+	assert.ErrorIs(t, err, ErrNoReposSelected)
+	// the default mock PRs are unreviewed or already merged
+	_, err = fs.Merge(newContext(), MergeRun{Org: "gh-org", Patch: "example", Method: MergeMethodMerge, Repos: []string{"gh-org/repo-1"}})
+	assert.ErrorIs(t, err, ErrNothingToMerge)
+}
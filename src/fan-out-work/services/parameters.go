@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type ParameterType string
+
+const (
+	ParameterString ParameterType = "string"
+	ParameterEnum   ParameterType = "enum"
+	ParameterBool   ParameterType = "bool"
+	ParameterSemver ParameterType = "semver"
+)
+
+// Parameter is an input a patch declares in its config.yml. A run passes each parameter's value to the patch
+// in the environment variable PATCH_<NAME>, e.g. PATCH_VERSION for a parameter named version.
+type Parameter struct {
+	Name        string        `yaml:"name"`
+	Type        ParameterType `yaml:"type"`
+	Description string        `yaml:"description"`
+	Default     string        `yaml:"default"`
+	Required    bool          `yaml:"required"`
+	Values      []string      `yaml:"values"`  // the choices of an enum
+	Pattern     string        `yaml:"pattern"` // a regular expression string values must match
+}
+
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+var (
+	parameterNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	// see https://semver.org/#is-there-a-suggested-regular-expression-regex-to-check-a-semver-string
+	semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+)
+
+func (p Parameter) EnvVar() string {
+	return "PATCH_" + strings.ToUpper(p.Name)
+}
+
+func (p Parameter) validateDeclaration() error {
+	if !parameterNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("invalid parameter name %q", p.Name)
+	}
+	switch p.Type {
+	case ParameterString, ParameterBool, ParameterSemver:
+		if len(p.Values) > 0 {
+			return fmt.Errorf("parameter %s: values are only allowed for enums", p.Name)
+		}
+	case ParameterEnum:
+		if len(p.Values) == 0 {
+			return fmt.Errorf("parameter %s: enums need values", p.Name)
+		}
+	default:
+		return fmt.Errorf("parameter %s: invalid type %q, expected one of %s, %s, %s or %s", p.Name, p.Type, ParameterString, ParameterEnum, ParameterBool, ParameterSemver)
+	}
+	if p.Pattern != "" {
+		if p.Type != ParameterString {
+			return fmt.Errorf("parameter %s: patterns are only allowed for strings", p.Name)
+		}
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("parameter %s: invalid pattern: %w", p.Name, err)
+		}
+	}
+	if p.Default != "" {
+		if _, err := p.normalise(p.Default); err != nil {
+			return fmt.Errorf("parameter %s: invalid default: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// normalise checks a value against the parameter's type, returning it in the form passed to the patch.
+func (p Parameter) normalise(value string) (string, error) {
+	switch p.Type {
+	case ParameterEnum:
+		if !slices.Contains(p.Values, value) {
+			return "", fmt.Errorf("%q is not one of %s", value, strings.Join(p.Values, ", "))
+		}
+	case ParameterBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a boolean", value)
+		}
+		return strconv.FormatBool(b), nil
+	case ParameterSemver:
+		if !semverRegex.MatchString(strings.TrimPrefix(value, "v")) {
+			return "", fmt.Errorf("%q is not a semantic version", value)
+		}
+	case ParameterString:
+		if p.Pattern != "" && !regexp.MustCompile(p.Pattern).MatchString(value) {
+			return "", fmt.Errorf("%q doesn't match %s", value, p.Pattern)
+		}
+	}
+	return value, nil
+}
+
+func validateParameterDeclarations(params []Parameter) error {
+	var errs []error
+	var names, envVars []string
+	for _, p := range params {
+		if slices.Contains(names, p.Name) {
+			errs = append(errs, fmt.Errorf("duplicate parameter %s", p.Name))
+		} else if slices.Contains(envVars, p.EnvVar()) {
+			// one would overwrite the other in the patch's environment
+			errs = append(errs, fmt.Errorf("parameter %s has the same environment variable, %s, as another parameter", p.Name, p.EnvVar()))
+		}
+		names = append(names, p.Name)
+		envVars = append(envVars, p.EnvVar())
+		if err := p.validateDeclaration(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveParameters validates the values given for a run, filling in defaults. Bools without a value or a
+// default are false; the run form always gives bools a value, so that an unticked one overrides a true default.
+func resolveParameters(params []Parameter, values map[string]string) (map[string]string, error) {
+	for name := range values {
+		if !slices.ContainsFunc(params, func(p Parameter) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("%w %s: the patch doesn't declare it", ErrInvalidParameter, name)
+		}
+	}
+	resolved := map[string]string{}
+	for _, p := range params {
+		value := strings.TrimSpace(values[p.Name])
+		if value == "" {
+			value = p.Default
+		}
+		if value == "" && p.Type == ParameterBool {
+			value = "false"
+		}
+		if value == "" {
+			if p.Required {
+				return nil, fmt.Errorf("%w %s: a value is required", ErrInvalidParameter, p.Name)
+			}
+			continue
+		}
+		normalised, err := p.normalise(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidParameter, p.Name, err)
+		}
+		resolved[p.Name] = normalised
+	}
+	return resolved, nil
+}
+
+// parameterEnv maps resolved parameter values onto the environment variables passed to the patch.
+func parameterEnv(params []Parameter, values map[string]string) []string {
+	var env []string
+	for _, p := range params {
+		if value, ok := values[p.Name]; ok {
+			env = append(env, p.EnvVar()+"="+value)
+		}
+	}
+	return env
+}
+
+// Parameters lists the parameters a patch declares.
+func (fs *FanoutServiceImpl) Parameters(patch string) ([]Parameter, error) {
+	p, err := fs.patch(patch)
+	if err != nil {
+		return []Parameter{}, err
+	}
+	return p.cfg.Parameters, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testParameters = []Parameter{
+	{Name: "version", Type: ParameterSemver, Required: true},
+	{Name: "channel", Type: ParameterEnum, Values: []string{"stable", "beta"}, Default: "stable"},
+	{Name: "force", Type: ParameterBool},
+	{Name: "ticket", Type: ParameterString, Pattern: `^[A-Z]+-\d+$`},
+}
+
+func TestResolveParameters(t *testing.T) {
+	values, err := resolveParameters(testParameters, map[string]string{"version": "v1.2.3-rc.1", "force": "1"})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, map[string]string{"version": "v1.2.3-rc.1", "channel": "stable", "force": "true"}, values)
+	env := parameterEnv(testParameters, values)
+	assert.Equal(t, []string{"PATCH_VERSION=v1.2.3-rc.1", "PATCH_CHANNEL=stable", "PATCH_FORCE=true"}, env)
+}
+
+func TestResolveParametersUntickedBool(t *testing.T) {
+	params := []Parameter{{Name: "cleanup", Type: ParameterBool, Default: "true"}}
+	values, err := resolveParameters(params, map[string]string{"cleanup": "false"})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, map[string]string{"cleanup": "false"}, values, "Expected an unticked bool to override its default")
+	values, err = resolveParameters(params, map[string]string{})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, map[string]string{"cleanup": "true"}, values)
+}
+
+func TestResolveParametersInvalid(t *testing.T) {
+	for _, values := range []map[string]string{
+		{},                                    // version is required
+		{"version": "1.2"},                    // not semver
+		{"version": "1.2.3", "channel": "x"},  // not one of the enum's values
+		{"version": "1.2.3", "ticket": "abc"}, // doesn't match the pattern
+		{"version": "1.2.3", "other": "x"},    // not declared
+	} {
+		_, err := resolveParameters(testParameters, values)
+		assert.ErrorIs(t, err, ErrInvalidParameter, "Expected %v to be invalid", values)
+	}
+}
+
+func TestParseConfigInvalidParameters(t *testing.T) {
+	_, err := parseConfig([]byte(`
+branch: b
+pr-title: t
+parameters:
+  - name: version
+    type: semver
+    default: latest
+  - name: version
+    type: enum
+  - name: 2fast
+    type: string
+  - name: mode
+    type: number
+`))
+	assert.EqualError(t, err, `parameter version: invalid default: "latest" is not a semantic version
+duplicate parameter version
+parameter version: enums need values
+invalid parameter name "2fast"
+parameter mode: invalid type "number", expected one of string, enum, bool or semver`)
+}
+
+func TestRunParameters(t *testing.T) {
+	capturedEnv = nil // reset env capture
+	defer func(dir string) { patchDir = dir }(patchDir)
+	patchDir = t.TempDir()
+	writePatch(t, patchDir, "bump", `
+branch: bump
+pr-title: Bump
+parameters:
+  - name: version
+    type: semver
+    required: true
+`)
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	pr := PatchRun{Org: "gh-org", Patch: "bump", DryRun: true, Parameters: map[string]string{"version": "2.0.0"}}
+	streamName, err := fs.Run(newContext(), pr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"PATCH_VERSION=2.0.0"}, capturedEnv)
+	record, err := fs.runStore.Get(streamName)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, map[string]string{"version": "2.0.0"}, record.Parameters)
+
+	_, err = fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "bump", DryRun: true})
+	assert.ErrorIs(t, err, ErrInvalidParameter)
+}
+
+func TestParseConfigParameterEnvCollision(t *testing.T) {
+	_, err := parseConfig([]byte(`
+branch: b
+pr-title: t
+parameters:
+  - name: version
+    type: semver
+  - name: Version
+    type: string
+`))
+	assert.EqualError(t, err, "parameter Version has the same environment variable, PATCH_VERSION, as another parameter")
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup can only kill the command itself on platforms without process groups.
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
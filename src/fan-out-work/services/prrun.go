@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+// pullRequestRun acts on a patch's PRs through the GitHub API rather than by running multi-gitter. It's
+// recorded, queued, streamed and cancelled like any other run.
+type pullRequestRun struct {
+	record       RunRecord
+	pullRequests []PullRequest
+	// act does something to a PR, returning a line of output saying what, and its result unless it was skipped
+	act func(pr PullRequest) (string, *RepoResult)
+	// finish is called once every PR has been acted on, before the run is recorded as done, if set
+	finish func(streamName string)
+}
+
+func (fs *FanoutServiceImpl) submitPullRequestRun(prr pullRequestRun) (string, error) {
+	streamName, err := generateStreamName()
+	if err != nil {
+		return "", err
+	}
+	prr.record.ID = streamName
+	prr.record.Status = RunStatusQueued
+	prr.record.StartedAt = time.Now()
+	err = fs.runStore.Create(prr.record)
+	if err != nil {
+		return "", err
+	}
+	fs.runQueue.submit(&queuedRun{
+		streamName: streamName,
+		user:       prr.record.User,
+		org:        prr.record.Org,
+		start: func(done func()) {
+			go fs.actOnPullRequests(streamName, prr, done)
+		},
+	})
+	return streamName, nil
+}
+
+// actOnPullRequests acts on PRs one at a time, recording the result for each, until they're all done or the run
+// is cancelled.
+func (fs *FanoutServiceImpl) actOnPullRequests(streamName string, prr pullRequestRun, done func()) {
+	defer done()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	// cancelling works as it does for patch runs
+	runningProcesses.Store(streamName, cancel)
+	defer runningProcesses.Delete(streamName)
+	err := fs.runStore.Update(streamName, func(r *RunRecord) {
+		r.Status = RunStatusRunning
+	})
+	if err != nil {
+		fs.failRun(streamName, err)
+		return
+	}
+	status := RunStatusSucceeded
+	var results []RepoResult
+	for _, pr := range prr.pullRequests {
+		if errors.Is(context.Cause(ctx), ErrRunCancelled) {
+			status = RunStatusCancelled
+			fs.appendOutput(streamName, ErrRunCancelled.Error())
+			break
+		}
+		line, result := prr.act(pr)
+		fs.appendOutput(streamName, line)
+		if result == nil {
+			continue
+		}
+		if result.Outcome == RepoOutcomeFailed && status == RunStatusSucceeded {
+			status = RunStatusFailed
+		}
+		results = append(results, *result)
+	}
+	if prr.finish != nil {
+		prr.finish(streamName)
+	}
+	err = fs.runStore.Update(streamName, func(r *RunRecord) {
+		r.Status = status
+		r.EndedAt = time.Now()
+		if status != RunStatusSucceeded {
+			r.ExitCode = 1
+		}
+		r.Results = results
+	})
+	if err != nil {
+		log.Printf("error recording run result: %v", err)
+	}
+}
+
+func (fs *FanoutServiceImpl) appendOutput(streamName string, line string) {
+	if err := fs.runStore.Append(streamName, line); err != nil {
+		log.Printf("error storing output: %v", err)
+	}
+}
+
+func pullRequestLabel(pr PullRequest) string {
+	return pr.Repo + " #" + strconv.Itoa(pr.Number)
+}
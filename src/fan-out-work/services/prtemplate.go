@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// PRTemplateData is what the pr-title and pr-body templates of a patch can refer to, e.g.
+//
+//	pr-body: |
+//	  Updates {{.Repo}}'s {{.DefaultBranch}} branch, see {{.TrackingIssueURL}}
+type PRTemplateData struct {
+	Repo             string // the repository's name, without its owner
+	Owner            string
+	DefaultBranch    string
+	Patch            string
+	RunID            string
+	User             string // the user who launched the run
+	TrackingIssueURL string // empty until a status check has created the tracking issue
+}
+
+// prTemplate parses the template for a PR option, failing on references to fields PRTemplateData lacks.
+func prTemplate(option string, text string) (*template.Template, error) {
+	t, err := template.New(option).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// executing against sample data catches unknown fields, which parsing alone doesn't
+	err = t.Execute(&bytes.Buffer{}, PRTemplateData{})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func renderPRTemplate(option string, text string, data PRTemplateData) (string, error) {
+	t, err := prTemplate(option, text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderPR renders the PR title and body for the given data.
+func (cfg config) renderPR(data PRTemplateData) (string, string, error) {
+	title, err := renderPRTemplate("pr-title", cfg.PRTitle, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := renderPRTemplate("pr-body", cfg.PRBody, data)
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
+
+// perRepo reports whether the PR title or body differ between repositories. multi-gitter opens every PR with
+// the same title and body, so these have to be rendered for each PR once it exists.
+func (cfg config) perRepo() bool {
+	title, body, err := cfg.renderPR(PRTemplateData{Repo: "a", Owner: "a", DefaultBranch: "a"})
+	if err != nil {
+		return false
+	}
+	otherTitle, otherBody, err := cfg.renderPR(PRTemplateData{Repo: "b", Owner: "b", DefaultBranch: "b"})
+	if err != nil {
+		return false
+	}
+	return title != otherTitle || body != otherBody
+}
+
+// trackingIssueURL finds the tracking issue recorded by the latest status check of a patch in an org.
+func (fs *FanoutServiceImpl) trackingIssueURL(org string, patch string) (string, error) {
+	records, err := fs.runStore.List()
+	if err != nil {
+		return "", fmt.Errorf("error listing runs: %w", err)
+	}
+	i := slices.IndexFunc(records, func(r RunRecord) bool {
+		return r.Org == org && r.Patch == patch && r.IssueURL != ""
+	})
+	if i < 0 {
+		return "", nil
+	}
+	return records[i].IssueURL, nil
+}
+
+// personalisePullRequests renders the PR title and body for each repository a run opened a PR in, and edits
+// the PRs to match. Failures are reported in the run's output rather than failing the run, whose changes
+// have been pushed by then.
+func (fs *FanoutServiceImpl) personalisePullRequests(streamName string, pr PatchRun, cfg config, data PRTemplateData) func(results []RepoResult) {
+	return func(results []RepoResult) {
+		for _, result := range results {
+			if result.Outcome != RepoOutcomeSucceeded || result.PRNumber == 0 {
+				continue
+			}
+			err := fs.personalisePullRequest(pr.AccessToken, result, cfg, data)
+			line := fmt.Sprintf("personalised %s #%d", result.Repo, result.PRNumber)
+			if err != nil {
+				line = fmt.Sprintf("error personalising %s #%d: %v", result.Repo, result.PRNumber, err)
+			}
+			if err := fs.runStore.Append(streamName, line); err != nil {
+				log.Printf("error storing output: %v", err)
+			}
+		}
+	}
+}
+
+func (fs *FanoutServiceImpl) personalisePullRequest(token string, result RepoResult, cfg config, data PRTemplateData) error {
+	owner, name, _ := strings.Cut(result.Repo, "/")
+	defaultBranch, err := fs.githubService.DefaultBranch(token, result.Repo)
+	if err != nil {
+		return err
+	}
+	data.Repo = name
+	data.Owner = owner
+	data.DefaultBranch = defaultBranch
+	title, body, err := cfg.renderPR(data)
+	if err != nil {
+		return err
+	}
+	return fs.githubService.EditPullRequest(token, result.Repo, result.PRNumber, title, body)
+}
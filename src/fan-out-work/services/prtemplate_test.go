@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPR(t *testing.T) {
+	cfg := config{
+		PRTitle: "{{.Patch}}: update {{.Repo}}",
+		PRBody:  "Targets {{.Owner}}/{{.Repo}}@{{.DefaultBranch}} for {{.User}} in {{.RunID}}, see {{.TrackingIssueURL}}",
+	}
+	title, body, err := cfg.renderPR(PRTemplateData{
+		Repo:             "api",
+		Owner:            "gh-org",
+		DefaultBranch:    "main",
+		Patch:            "example",
+		RunID:            "run-1",
+		User:             "octocat",
+		TrackingIssueURL: "issue link",
+	})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, "example: update api", title)
+	assert.Equal(t, "Targets gh-org/api@main for octocat in run-1, see issue link", body)
+	assert.True(t, cfg.perRepo())
+	assert.False(t, config{PRTitle: "{{.Patch}}", PRBody: "static"}.perRepo())
+}
+
+func TestParseConfigInvalidTemplate(t *testing.T) {
+	_, err := parseConfig([]byte("branch: b\npr-title: '{{.Repository}}'\npr-body: '{{if}}'\n"))
+	assert.ErrorContains(t, err, "invalid pr-title template")
+	assert.ErrorContains(t, err, "can't evaluate field Repository")
+	assert.ErrorContains(t, err, "invalid pr-body template")
+}
+
+func TestPersonalisePullRequests(t *testing.T) {
+	capturedEdits = nil // reset edit capture
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	if err := fs.runStore.Create(RunRecord{ID: "run", Status: RunStatusRunning}); err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	cfg := config{PRTitle: "Update {{.Repo}}", PRBody: "Merges into {{.DefaultBranch}}, started by {{.User}}"}
+	finish := fs.personalisePullRequests("run", PatchRun{AccessToken: "gh-api-token"}, cfg, PRTemplateData{User: "octocat"})
+	finish([]RepoResult{
+		{Repo: "gh-org/api", Outcome: RepoOutcomeSucceeded, PRNumber: 12},
+		{Repo: "gh-org/web", Outcome: RepoOutcomeNoChange},
+	})
+	expected := []pullRequestEdit{
+		{repo: "gh-org/api", number: 12, title: "Update api", body: "Merges into main, started by octocat"},
+	}
+	assert.Equal(t, expected, capturedEdits)
+	lines, err := fs.runStore.Output("run")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"personalised gh-org/api #12"}, lines)
+}
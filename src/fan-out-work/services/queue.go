@@ -0,0 +1,135 @@
+package services
+
+import (
+	"slices"
+	"sync"
+)
+
+var (
+	maxConcurrentRuns       = intFromEnv("MAX_CONCURRENT_RUNS", 4)
+	maxConcurrentRunsPerOrg = intFromEnv("MAX_CONCURRENT_RUNS_PER_ORG", 2)
+)
+
+type queuedRun struct {
+	streamName string
+	user       string
+	org        string
+	// start launches the run, which must call done once it has finished.
+	start func(done func())
+}
+
+// runQueue bounds how many runs execute at once, globally and per org. Free slots are handed out round-robin
+// between users so that one user queueing many runs can't starve everyone else. A limit of zero is unlimited.
+type runQueue struct {
+	mu        sync.Mutex
+	maxRuns   int
+	maxPerOrg int
+	running   int
+	perOrg    map[string]int
+	waiting   []*queuedRun // in arrival order
+	lastUser  string       // the user most recently given a slot
+}
+
+func newRunQueue(maxRuns int, maxPerOrg int) *runQueue {
+	return &runQueue{
+		maxRuns:   maxRuns,
+		maxPerOrg: maxPerOrg,
+		perOrg:    map[string]int{},
+	}
+}
+
+func (q *runQueue) submit(qr *queuedRun) {
+	q.mu.Lock()
+	q.waiting = append(q.waiting, qr)
+	q.mu.Unlock()
+	q.dispatch()
+}
+
+// remove drops a run that hasn't started yet, reporting whether it was still waiting.
+func (q *runQueue) remove(streamName string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.waiting, func(qr *queuedRun) bool {
+		return qr.streamName == streamName
+	})
+	if i < 0 {
+		return false
+	}
+	q.waiting = slices.Delete(q.waiting, i, i+1)
+	return true
+}
+
+// position returns the 1-based place of a waiting run in arrival order, or 0 if it isn't waiting.
+func (q *runQueue) position(streamName string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.IndexFunc(q.waiting, func(qr *queuedRun) bool {
+		return qr.streamName == streamName
+	}) + 1
+}
+
+func (q *runQueue) dispatch() {
+	var ready []*queuedRun
+	q.mu.Lock()
+	for {
+		qr := q.next()
+		if qr == nil {
+			break
+		}
+		q.running++
+		q.perOrg[qr.org]++
+		q.lastUser = qr.user
+		ready = append(ready, qr)
+	}
+	q.mu.Unlock()
+
+	for _, qr := range ready {
+		qr.start(q.releaseFunc(qr))
+	}
+}
+
+// next takes the next run allowed to start, if any; the caller must hold the lock.
+func (q *runQueue) next() *queuedRun {
+	if q.maxRuns > 0 && q.running >= q.maxRuns {
+		return nil
+	}
+	var users []string
+	for _, qr := range q.waiting {
+		if !slices.Contains(users, qr.user) {
+			users = append(users, qr.user)
+		}
+	}
+	// start with the user after the one most recently served
+	slices.Sort(users)
+	i, _ := slices.BinarySearch(users, q.lastUser)
+	if i < len(users) && users[i] == q.lastUser {
+		i++
+	}
+	users = append(users[i:], users[:i]...)
+	for _, user := range users {
+		for j, qr := range q.waiting {
+			if qr.user != user || (q.maxPerOrg > 0 && q.perOrg[qr.org] >= q.maxPerOrg) {
+				continue
+			}
+			q.waiting = slices.Delete(q.waiting, j, j+1)
+			return qr
+		}
+	}
+	return nil
+}
+
+func (q *runQueue) releaseFunc(qr *queuedRun) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.running--
+			q.perOrg[qr.org]--
+			if q.perOrg[qr.org] == 0 {
+				delete(q.perOrg, qr.org)
+			}
+			q.mu.Unlock()
+			q.dispatch()
+		})
+	}
+}
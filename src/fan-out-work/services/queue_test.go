@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunQueue(t *testing.T) {
+	q := newRunQueue(2, 1)
+	var started []string
+	done := map[string]func(){}
+	submit := func(streamName string, user string, org string) {
+		q.submit(&queuedRun{
+			streamName: streamName,
+			user:       user,
+			org:        org,
+			start: func(release func()) {
+				started = append(started, streamName)
+				done[streamName] = release
+			},
+		})
+	}
+	submit("alice-1", "alice", "howdy")
+	submit("alice-2", "alice", "howdy") // howdy is at its org limit
+	submit("alice-3", "alice", "there")
+	submit("bob-1", "bob", "howdy")
+	submit("carol-1", "carol", "there") // global limit reached
+	assert.Equal(t, []string{"alice-1", "alice-3"}, started)
+	assert.Equal(t, 1, q.position("alice-2"))
+	assert.Equal(t, 3, q.position("carol-1"))
+
+	// bob and carol are served before alice gets another slot
+	done["alice-1"]()
+	assert.Equal(t, []string{"alice-1", "alice-3", "bob-1"}, started)
+	done["alice-3"]()
+	assert.Equal(t, []string{"alice-1", "alice-3", "bob-1", "carol-1"}, started)
+
+	assert.True(t, q.remove("alice-2"))
+	assert.False(t, q.remove("alice-2"))
+	done["bob-1"]()
+	assert.Equal(t, []string{"alice-1", "alice-3", "bob-1", "carol-1"}, started)
+	assert.Equal(t, 0, q.position("alice-2"))
+}
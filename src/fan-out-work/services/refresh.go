@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RefreshStrategy string
+
+const (
+	// RefreshReplace runs the patch again on the default branch, force-pushing the result over each PR branch.
+	RefreshReplace RefreshStrategy = "replace"
+	// RefreshRebase rebases each PR branch onto its base branch, keeping the commits already on it.
+	RefreshRebase RefreshStrategy = "rebase"
+)
+
+var (
+	ErrInvalidRefreshStrategy = errors.New("invalid refresh strategy")
+	ErrNothingToRefresh       = errors.New("there are no open pull requests to refresh")
+	ErrNoRunToReplace         = errors.New("the patch hasn't been run for real in the org, there's nothing to replace its PRs with")
+	ErrPatchChangedSinceRun   = errors.New("the patch has changed since it opened its PRs, dry run and run it again instead")
+)
+
+// RefreshRun brings the open PRs of a patch up to date with their base branches; merged and closed PRs are
+// left alone.
+type RefreshRun struct {
+	AccessToken string
+	User        string
+	Org         string
+	Patch       string
+	Strategy    RefreshStrategy
+}
+
+// Refresh brings a patch's open PRs up to date, streaming the outcome for each as the output of a run: updated,
+// already current, or, when rebasing, conflicted.
+func (fs *FanoutServiceImpl) Refresh(c echo.Context, rr RefreshRun) (string, error) {
+	if rr.Strategy != RefreshReplace && rr.Strategy != RefreshRebase {
+		return "", fmt.Errorf("%w %q, expected %s or %s", ErrInvalidRefreshStrategy, rr.Strategy, RefreshReplace, RefreshRebase)
+	}
+	patch, err := fs.patch(rr.Patch)
+	if err != nil {
+		return "", err
+	}
+	pullRequests, err := fs.githubService.PullRequests(rr.AccessToken, rr.Org, patch.cfg.Branch, patch.cfg.headOwner(rr.Org))
+	if err != nil {
+		return "", fmt.Errorf("error listing pull requests: %w", err)
+	}
+	var open []PullRequest
+	for _, pr := range pullRequests {
+		if pr.State == PullRequestOpen {
+			open = append(open, pr)
+		}
+	}
+	if len(open) == 0 {
+		return "", ErrNothingToRefresh
+	}
+	if rr.Strategy == RefreshReplace {
+		return fs.replacePullRequests(c, rr, patch.cfg, open)
+	}
+	streamName, err := fs.submitPullRequestRun(pullRequestRun{
+		record: RunRecord{
+			Kind:            RunKindRefresh,
+			User:            rr.User,
+			Org:             rr.Org,
+			Patch:           rr.Patch,
+			RefreshStrategy: rr.Strategy,
+		},
+		pullRequests: open,
+		act: func(pr PullRequest) (string, *RepoResult) {
+			label := pullRequestLabel(pr)
+			result := &RepoResult{Repo: pr.Repo, PRURL: pr.URL, PRNumber: pr.Number}
+			updated, err := fs.githubService.RebasePullRequestBranch(rr.AccessToken, pr.Repo, pr.Number)
+			switch {
+			case errors.Is(err, ErrBranchConflict):
+				result.Outcome = RepoOutcomeConflicted
+				result.Error = err.Error()
+				return fmt.Sprintf("%s conflicts with its base branch", label), result
+			case err != nil:
+				result.Outcome = RepoOutcomeFailed
+				result.Error = err.Error()
+				return fmt.Sprintf("failed to rebase %s: %v", label, err), result
+			case updated:
+				result.Outcome = RepoOutcomeUpdated
+				return "rebased " + label, result
+			default:
+				result.Outcome = RepoOutcomeCurrent
+				return label + " is already current", result
+			}
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error recording refresh: %w", err)
+	}
+	return streamName, nil
+}
+
+// replaceRefresh is what a refresh in replace mode carries into the run that regenerates the PR branches.
+type replaceRefresh struct {
+	patchHash    string                 // the content of the patch the PRs were opened with
+	pullRequests map[string]PullRequest // the open PRs by repository, as they were before the refresh
+}
+
+// replacePullRequests runs the patch again, limited to the repositories with open PRs, with the parameters of
+// its latest real run in the org. The patch must be the one that run ran: regenerating the PRs with a patch
+// that hasn't been dry run would skip the dry run a real run needs.
+func (fs *FanoutServiceImpl) replacePullRequests(c echo.Context, rr RefreshRun, cfg config, open []PullRequest) (string, error) {
+	refresh := &replaceRefresh{pullRequests: map[string]PullRequest{}}
+	var repos []string
+	for _, pr := range open {
+		repos = append(repos, pr.Repo)
+		refresh.pullRequests[pr.Repo] = pr
+	}
+	records, err := fs.runStore.List()
+	if err != nil {
+		return "", fmt.Errorf("error listing runs: %w", err)
+	}
+	i := slices.IndexFunc(records, func(r RunRecord) bool {
+		return r.Kind == RunKindPatch && !r.DryRun && r.Org == rr.Org && r.Patch == rr.Patch
+	})
+	if i == -1 {
+		return "", ErrNoRunToReplace
+	}
+	refresh.patchHash = records[i].PatchHash
+	return fs.Run(c, PatchRun{
+		AccessToken: rr.AccessToken,
+		User:        rr.User,
+		Org:         rr.Org,
+		Patch:       rr.Patch,
+		SelectRepos: true,
+		Selected:    repos,
+		Parameters:  records[i].Parameters,
+		refresh:     refresh,
+	})
+}
+
+// currentPullRequests reports the PRs a refresh in replace mode left as they were as already current rather
+// than updated: multi-gitter force-pushes a regenerated branch even when its content hasn't changed.
+func (fs *FanoutServiceImpl) currentPullRequests(streamName string, pr PatchRun, cfg config) func(results []RepoResult) {
+	return func(results []RepoResult) {
+		refreshed, err := fs.githubService.PullRequests(pr.AccessToken, pr.Org, cfg.Branch, cfg.headOwner(pr.Org))
+		if err != nil {
+			fs.appendOutput(streamName, fmt.Sprintf("error checking which pull requests were already current: %v", err))
+			return
+		}
+		heads := map[string]string{}
+		for _, after := range refreshed {
+			heads[after.Repo] = after.HeadSHA
+		}
+		for i, result := range results {
+			before, ok := pr.refresh.pullRequests[result.Repo]
+			if result.Outcome != RepoOutcomeUpdated || !ok {
+				continue
+			}
+			current, err := fs.sameContent(pr.AccessToken, result.Repo, before.HeadSHA, heads[result.Repo])
+			if err != nil {
+				fs.appendOutput(streamName, fmt.Sprintf("error checking whether %s was already current: %v", pullRequestLabel(before), err))
+				continue
+			}
+			if current {
+				results[i].Outcome = RepoOutcomeCurrent
+				fs.appendOutput(streamName, pullRequestLabel(before)+" is already current")
+			}
+		}
+	}
+}
+
+// sameContent reports whether two commits of a repository have the same content.
+func (fs *FanoutServiceImpl) sameContent(token string, repo string, before string, after string) (bool, error) {
+	if before == after {
+		return true, nil
+	}
+	if before == "" || after == "" {
+		return false, nil
+	}
+	beforeTree, err := fs.githubService.TreeSHA(token, repo, before)
+	if err != nil {
+		return false, err
+	}
+	afterTree, err := fs.githubService.TreeSHA(token, repo, after)
+	if err != nil {
+		return false, err
+	}
+	return beforeTree == afterTree, nil
+}
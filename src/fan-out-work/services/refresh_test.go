@@ -0,0 +1,157 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var refreshPullRequests = []PullRequest{
+	{Repo: "gh-org/stale", Number: 1, URL: "pr 1", State: PullRequestOpen},
+	{Repo: "gh-org/current", Number: 2, URL: "pr 2", State: PullRequestOpen},
+	{Repo: "gh-org/conflicted", Number: 3, URL: "pr 3", State: PullRequestOpen},
+	{Repo: "gh-org/merged", Number: 4, URL: "pr 4", State: PullRequestMerged},
+}
+
+func TestRefreshRebase(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = refreshPullRequests
+	fs := NewMockFanoutService(t)
+	id, err := fs.Refresh(newContext(), RefreshRun{Org: "gh-org", Patch: "example", Strategy: RefreshRebase})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	record := waitForRun(t, runStore, id)
+	assert.Equal(t, RunKindRefresh, record.Kind)
+	assert.Equal(t, RefreshRebase, record.RefreshStrategy)
+	assert.Equal(t, RunStatusSucceeded, record.Status, "Expected conflicts to be reported rather than fail the refresh")
+	assert.Equal(t, []RepoResult{
+		{Repo: "gh-org/stale", Outcome: RepoOutcomeUpdated, PRURL: "pr 1", PRNumber: 1},
+		{Repo: "gh-org/current", Outcome: RepoOutcomeCurrent, PRURL: "pr 2", PRNumber: 2},
+		{Repo: "gh-org/conflicted", Outcome: RepoOutcomeConflicted, PRURL: "pr 3", PRNumber: 3, Error: "the branch conflicts with its base branch: rebase conflict between base and head"},
+	}, record.Results)
+}
+
+// recordRealRun records a real run of the example patch in gh-org, as the run a replacing refresh reuses.
+func recordRealRun(t *testing.T, fs FanoutService, patchHash string) {
+	err := fs.(*FanoutServiceImpl).runStore.Create(RunRecord{
+		ID:         "real-run",
+		Kind:       RunKindPatch,
+		Org:        "gh-org",
+		Patch:      "example",
+		Parameters: map[string]string{},
+		PatchHash:  patchHash,
+		Status:     RunStatusSucceeded,
+	})
+	if err != nil {
+		t.Fatalf("recording run: %v", err)
+	}
+}
+
+func TestRefreshReplace(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = refreshPullRequests
+	capturedArgs = []string{}
+	fs := NewMockFanoutService(t)
+	patchHash, err := hashPatch(patchDir, "example")
+	if err != nil {
+		t.Fatalf("hashing patch: %v", err)
+	}
+	recordRealRun(t, fs, patchHash)
+	id, err := fs.Refresh(newContext(), RefreshRun{AccessToken: "gh-api-token", Org: "gh-org", Patch: "example", Strategy: RefreshReplace})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record, err := fs.(*FanoutServiceImpl).runStore.Get(id)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, RunKindRefresh, record.Kind)
+	assert.Equal(t, RefreshReplace, record.RefreshStrategy)
+	assert.Equal(t, []string{"gh-org/stale", "gh-org/current", "gh-org/conflicted"}, record.Targets.Repos)
+	args := strings.Join(capturedArgs, " ")
+	assert.Contains(t, args, "--repo gh-org/stale --repo gh-org/current --repo gh-org/conflicted")
+	assert.Contains(t, args, "--conflict-strategy replace")
+	assert.NotContains(t, capturedArgs, "--dry-run")
+}
+
+func TestRefreshReplacePatchChanged(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = refreshPullRequests
+	fs := NewMockFanoutService(t)
+	_, err := fs.Refresh(newContext(), RefreshRun{Org: "gh-org", Patch: "example", Strategy: RefreshReplace})
+	assert.ErrorIs(t, err, ErrNoRunToReplace)
+	recordRealRun(t, fs, "an older patch")
+	_, err = fs.Refresh(newContext(), RefreshRun{Org: "gh-org", Patch: "example", Strategy: RefreshReplace})
+	assert.ErrorIs(t, err, ErrPatchChangedSinceRun)
+}
+
+func TestRefreshReplaceCurrent(t *testing.T) {
+	defer func(pullRequests []PullRequest, trees map[string]string) {
+		mockPullRequests = pullRequests
+		mockTrees = trees
+	}(mockPullRequests, mockTrees)
+	// stale was regenerated with new content, current with the content it had and unpushed wasn't pushed at all
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/stale", Number: 1, HeadSHA: "stale-after"},
+		{Repo: "gh-org/current", Number: 2, HeadSHA: "current-after"},
+		{Repo: "gh-org/unpushed", Number: 3, HeadSHA: "unpushed-before"},
+	}
+	mockTrees = map[string]string{"current-before": "current-tree", "current-after": "current-tree"}
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	if err := fs.runStore.Create(RunRecord{ID: "refresh", Status: RunStatusRunning}); err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	pr := PatchRun{Org: "gh-org", refresh: &replaceRefresh{pullRequests: map[string]PullRequest{
+		"gh-org/stale":    {Repo: "gh-org/stale", Number: 1, HeadSHA: "stale-before"},
+		"gh-org/current":  {Repo: "gh-org/current", Number: 2, HeadSHA: "current-before"},
+		"gh-org/unpushed": {Repo: "gh-org/unpushed", Number: 3, HeadSHA: "unpushed-before"},
+	}}}
+	results := []RepoResult{
+		{Repo: "gh-org/stale", Outcome: RepoOutcomeUpdated},
+		{Repo: "gh-org/current", Outcome: RepoOutcomeUpdated},
+		{Repo: "gh-org/unpushed", Outcome: RepoOutcomeUpdated},
+		{Repo: "gh-org/broken", Outcome: RepoOutcomeFailed},
+	}
+	fs.currentPullRequests("refresh", pr, config{Branch: "fan-out-patch"})(results)
+	assert.Equal(t, []RepoOutcome{RepoOutcomeUpdated, RepoOutcomeCurrent, RepoOutcomeCurrent, RepoOutcomeFailed}, []RepoOutcome{
+		results[0].Outcome, results[1].Outcome, results[2].Outcome, results[3].Outcome,
+	})
+	output, err := fs.runStore.Output("refresh")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"gh-org/current #2 is already current", "gh-org/unpushed #3 is already current"}, output)
+}
+
+func TestRefreshNothing(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = refreshPullRequests[3:]
+	fs := NewMockFanoutService(t)
+	_, err := fs.Refresh(newContext(), RefreshRun{Org: "gh-org", Patch: "example", Strategy: RefreshRebase})
+	assert.ErrorIs(t, err, ErrNothingToRefresh)
+	_, err = fs.Refresh(newContext(), RefreshRun{Org: "gh-org", Patch: "example", Strategy: "merge"})
+	assert.ErrorIs(t, err, ErrInvalidRefreshStrategy)
+}
+
+func TestRunExecutorOutcomes(t *testing.T) {
+	fakeMultiGitter(t, "echo 'Repositories with a successful run:'\necho '  gh-org/stale #1'\n")
+	runStore, err := NewFileRunStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating run store: %v", err)
+	}
+	if err := runStore.Create(RunRecord{ID: "run", Status: RunStatusRunning}); err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	ex := &runExecutorImpl{runStore: runStore}
+	err = ex.Run(executorRun{streamName: "run", outcomes: map[RepoOutcome]RepoOutcome{RepoOutcomeSucceeded: RepoOutcomeUpdated}})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record := waitForRun(t, runStore, "run")
+	assert.Equal(t, RepoOutcomeUpdated, record.Results[0].Outcome)
+}
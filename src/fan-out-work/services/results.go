@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const githubURL = "https://github.com"
+
+type RepoOutcome string
+
+const (
+	// RepoOutcomeSucceeded means changes were pushed and a PR opened or updated, or would have been in a dry run.
+	RepoOutcomeSucceeded RepoOutcome = "succeeded"
+	RepoOutcomeNoChange  RepoOutcome = "no change"
+	RepoOutcomeFailed    RepoOutcome = "failed"
+	RepoOutcomeMerged    RepoOutcome = "merged"
+	RepoOutcomeWithdrawn RepoOutcome = "withdrawn"
+	// RepoOutcomeUpdated, RepoOutcomeCurrent and RepoOutcomeConflicted are the outcomes of refreshing a PR branch.
+	RepoOutcomeUpdated    RepoOutcome = "updated"
+	RepoOutcomeCurrent    RepoOutcome = "already current"
+	RepoOutcomeConflicted RepoOutcome = "conflicted"
+)
+
+// RepoResult is the outcome of a run for a single repository.
+type RepoResult struct {
+	Repo     string      `json:"repo"`
+	Outcome  RepoOutcome `json:"outcome"`
+	PRURL    string      `json:"pr_url,omitempty"`
+	PRNumber int         `json:"pr_number,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+const (
+	successHeading  = "Repositories with a successful run"
+	noChangeHeading = "No data was changed"
+)
+
+var (
+	// multi-gitter ends a run by listing repositories under a heading per outcome, e.g.
+	//
+	//	No data was changed:
+	//	  org/repo-a
+	//	Repositories with a successful run:
+	//	  org/repo-b #12
+	resultHeadingRegex = regexp.MustCompile(`^([A-Z][^=]*):$`)
+	resultRepoRegex    = regexp.MustCompile(`^  ([\w.-]+/[\w.-]+)(?: #(\d+))?$`)
+)
+
+// parseResults extracts per-repository results from the plain output of multi-gitter run.
+func parseResults(lines []string) []RepoResult {
+	var results []RepoResult
+	heading := ""
+	for _, line := range lines {
+		if matches := resultHeadingRegex.FindStringSubmatch(line); matches != nil {
+			heading = matches[1]
+			continue
+		}
+		matches := resultRepoRegex.FindStringSubmatch(line)
+		if matches == nil {
+			heading = ""
+			continue
+		}
+		if heading == "" {
+			continue
+		}
+		result := RepoResult{Repo: matches[1]}
+		switch heading {
+		case successHeading:
+			result.Outcome = RepoOutcomeSucceeded
+			if matches[2] != "" {
+				result.PRNumber, _ = strconv.Atoi(matches[2])
+				result.PRURL = fmt.Sprintf("%s/%s/pull/%d", githubURL, matches[1], result.PRNumber)
+			}
+		case noChangeHeading:
+			result.Outcome = RepoOutcomeNoChange
+		default:
+			result.Outcome = RepoOutcomeFailed
+			result.Error = strings.ToLower(heading[:1]) + heading[1:]
+		}
+		results = append(results, result)
+	}
+	return results
+}
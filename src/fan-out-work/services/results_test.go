@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResults(t *testing.T) {
+	lines := []string{
+		`time="2025-09-01T12:00:00Z" level=info msg="Cloning and running script" repo=gh-org/unchanged`,
+		"No data was changed:",
+		"  gh-org/unchanged",
+		"Exit status 1:",
+		"  gh-org/broken",
+		"Repositories with a successful run:",
+		"  gh-org/changed #12",
+		"  gh-org/dry.run",
+	}
+	expected := []RepoResult{
+		{Repo: "gh-org/unchanged", Outcome: RepoOutcomeNoChange},
+		{Repo: "gh-org/broken", Outcome: RepoOutcomeFailed, Error: "exit status 1"},
+		{Repo: "gh-org/changed", Outcome: RepoOutcomeSucceeded, PRURL: "https://github.com/gh-org/changed/pull/12", PRNumber: 12},
+		{Repo: "gh-org/dry.run", Outcome: RepoOutcomeSucceeded},
+	}
+	assert.Equal(t, expected, parseResults(lines))
+	assert.Empty(t, parseResults([]string{"  gh-org/no-heading"}))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"slices"
+	"sync"
+)
+
+// runLog is the append-only output of a live run, shared by every viewer following it.
+type runLog struct {
+	mu      sync.Mutex
+	lines   []string
+	done    bool
+	changed chan struct{} // closed and replaced whenever lines are appended or the log is closed
+}
+
+func newRunLog() *runLog {
+	return &runLog{changed: make(chan struct{})}
+}
+
+func (l *runLog) append(lines ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, lines...)
+	l.notify()
+}
+
+func (l *runLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done = true
+	l.notify()
+}
+
+// notify wakes up waiting viewers; the caller must hold the lock.
+func (l *runLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// read returns the lines from cursor onwards, the cursor to continue from, whether the log is closed, and a
+// channel closed on the next change to the log.
+func (l *runLog) read(cursor int) ([]string, int, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cursor = min(max(cursor, 0), len(l.lines))
+	return slices.Clone(l.lines[cursor:]), len(l.lines), l.done, l.changed
+}
+
+// liveRunStore mirrors the output of runs in progress into shared in-memory logs. A run's log is dropped once
+// the run is done, after which its output is only read back from the underlying store.
+type liveRunStore struct {
+	RunStore
+	logs sync.Map
+}
+
+func newLiveRunStore(runStore RunStore) *liveRunStore {
+	return &liveRunStore{RunStore: runStore}
+}
+
+func (s *liveRunStore) Create(r RunRecord) error {
+	if err := s.RunStore.Create(r); err != nil {
+		return err
+	}
+	if !r.Done() {
+		s.logs.Store(r.ID, newRunLog())
+	}
+	return nil
+}
+
+func (s *liveRunStore) Append(id string, lines ...string) error {
+	// the durable copy is written first so that a reader never finds lines in memory that the store lacks
+	if err := s.RunStore.Append(id, lines...); err != nil {
+		return err
+	}
+	if l, ok := s.live(id); ok {
+		l.append(lines...)
+	}
+	return nil
+}
+
+func (s *liveRunStore) Update(id string, fn func(r *RunRecord)) error {
+	var updated RunRecord
+	err := s.RunStore.Update(id, func(r *RunRecord) {
+		fn(r)
+		updated = *r
+	})
+	if err != nil {
+		return err
+	}
+	if l, ok := s.live(id); ok && updated.Done() {
+		s.logs.Delete(id)
+		l.close()
+	}
+	return nil
+}
+
+func (s *liveRunStore) live(id string) (*runLog, bool) {
+	l, ok := s.logs.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return l.(*runLog), true
+}
+
+// read returns a run's output from cursor onwards along with the cursor to continue from.
+func (s *liveRunStore) read(id string, cursor int) ([]string, int, error) {
+	if l, ok := s.live(id); ok {
+		lines, next, _, _ := l.read(cursor)
+		return lines, next, nil
+	}
+	lines, err := s.RunStore.Output(id)
+	if err != nil {
+		return []string{}, 0, err
+	}
+	cursor = min(max(cursor, 0), len(lines))
+	return lines[cursor:], len(lines), nil
+}
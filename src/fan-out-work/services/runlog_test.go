@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputMultipleReaders(t *testing.T) {
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	err := fs.runStore.Create(RunRecord{ID: "run", Status: RunStatusRunning})
+	if err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	assert.Nil(t, fs.runStore.Append("run", "line 1", "line 2"))
+
+	first, err := fs.Output("run", 0)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"line 1", "line 2"}, first.Lines)
+	assert.Equal(t, 2, first.Cursor)
+	second, err := fs.Output("run", 0)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, first.Lines, second.Lines, "Expected every reader to see the whole output")
+
+	assert.Nil(t, fs.runStore.Append("run", "line 3"))
+	next, err := fs.Output("run", first.Cursor)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"line 3"}, next.Lines)
+	assert.False(t, next.Run.Done())
+
+	err = fs.runStore.Update("run", func(r *RunRecord) {
+		r.Status = RunStatusSucceeded
+	})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	_, ok := fs.runStore.live("run")
+	assert.False(t, ok, "Expected the live log to be dropped once the run is done")
+	offset, err := fs.Output("run", 1)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"line 2", "line 3"}, offset.Lines)
+	assert.Equal(t, 3, offset.Cursor)
+	assert.True(t, offset.Run.Done())
+}
+
+func TestStream(t *testing.T) {
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	err := fs.runStore.Create(RunRecord{ID: "run", Org: "howdy", Status: RunStatusRunning})
+	if err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	assert.Nil(t, fs.runStore.Append("run", "line 1"))
+	var lines []string
+	var last RunOutput
+	err = fs.Stream(newContext(), "run", 0, func(out RunOutput) error {
+		last = out
+		if out.Run.Done() {
+			return nil
+		}
+		lines = append(lines, out.Lines...)
+		if out.Cursor == 1 {
+			go func() {
+				assert.Nil(t, fs.runStore.Append("run", "line 2"))
+				assert.Nil(t, fs.runStore.Update("run", func(r *RunRecord) {
+					r.Status = RunStatusSucceeded
+				}))
+			}()
+		}
+		return nil
+	})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"line 1"}, lines[:1])
+	assert.True(t, last.Run.Done(), "Expected the last update to report the run as done")
+	assert.Equal(t, []string{"line 1", "line 2"}, last.Lines, "Expected the last update to carry the whole output")
+	assert.Equal(t, 2, last.Cursor)
+}
+
+func TestStreamOtherOrg(t *testing.T) {
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	// not one of the user's orgs
+	err := fs.runStore.Create(RunRecord{ID: "run", Org: "hidden", Status: RunStatusRunning})
+	if err != nil {
+		t.Fatalf("creating run: %v", err)
+	}
+	assert.Nil(t, fs.runStore.Append("run", "secret"))
+	err = fs.Stream(newContext(), "run", 0, func(out RunOutput) error {
+		t.Errorf("Expected no output, got %v", out.Lines)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrRunNotFound)
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunKind is what a run does; runs of patches are the default.
+type RunKind string
+
+const (
+	RunKindPatch RunKind = ""
+	// RunKindMerge merges the PRs a patch opened.
+	RunKindMerge RunKind = "merge"
+	// RunKindWithdraw closes the PRs a patch opened.
+	RunKindWithdraw RunKind = "withdraw"
+	// RunKindRefresh brings the open PRs of a patch up to date.
+	RunKindRefresh RunKind = "refresh"
+)
+
+type RunStatus string
+
+const (
+	RunStatusQueued      RunStatus = "queued"
+	RunStatusRunning     RunStatus = "running"
+	RunStatusSucceeded   RunStatus = "succeeded"
+	RunStatusFailed      RunStatus = "failed"
+	RunStatusCancelled   RunStatus = "cancelled"
+	RunStatusTimedOut    RunStatus = "timed out"
+	RunStatusInterrupted RunStatus = "interrupted"
+)
+
+// RunRecord is the durable record of a single patch run.
+type RunRecord struct {
+	ID              string            `json:"id"`
+	Kind            RunKind           `json:"kind,omitempty"`
+	User            string            `json:"user"`
+	Org             string            `json:"org"`
+	Patch           string            `json:"patch"`
+	DryRun          bool              `json:"dry_run"`
+	Targets         Targets           `json:"targets,omitzero"`
+	Parameters      map[string]string `json:"parameters,omitempty"`
+	PatchRevision   string            `json:"patch_revision,omitempty"` // the commit of the patches the run used, if versioned
+	PatchHash       string            `json:"patch_hash,omitempty"`     // the content of the patch folder the run used
+	DryRunID        string            `json:"dry_run_id,omitempty"`     // the dry run a real run followed up on
+	MergeMethod     MergeMethod       `json:"merge_method,omitempty"`
+	Comment         string            `json:"comment,omitempty"` // posted on the PRs a withdrawal closed
+	DeleteBranches  bool              `json:"delete_branches,omitempty"`
+	RefreshStrategy RefreshStrategy   `json:"refresh_strategy,omitempty"`
+	Status          RunStatus         `json:"status"`
+	StartedAt       time.Time         `json:"started_at"`
+	EndedAt         time.Time         `json:"ended_at,omitzero"`
+	ExitCode        int               `json:"exit_code"`
+	IssueURL        string            `json:"issue_url,omitempty"`
+	Results         []RepoResult      `json:"results,omitempty"`
+	// QueuePosition is the 1-based place of a queued run in the queue; it isn't stored.
+	QueuePosition int `json:"-"`
+}
+
+func (r RunRecord) Done() bool {
+	return r.Status != RunStatusQueued && r.Status != RunStatusRunning
+}
+
+func (r RunRecord) Duration() time.Duration {
+	if !r.Done() {
+		return time.Since(r.StartedAt)
+	}
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// ChangedRepos lists the repositories a run changed, or would have changed in a dry run.
+func (r RunRecord) ChangedRepos() []string {
+	var repos []string
+	for _, result := range r.Results {
+		if result.Outcome == RepoOutcomeSucceeded {
+			repos = append(repos, result.Repo)
+		}
+	}
+	return repos
+}
+
+type RunStore interface {
+	Create(r RunRecord) error
+	Update(id string, fn func(r *RunRecord)) error
+	Append(id string, lines ...string) error
+	Get(id string) (RunRecord, error)
+	Output(id string) ([]string, error)
+	List() ([]RunRecord, error)
+}
+
+var ErrRunNotFound = errors.New("run not found")
+
+const (
+	recordExt = ".json"
+	outputExt = ".log"
+)
+
+// FileRunStore keeps each run as a JSON record next to an append-only output log.
+//
+// A store directory is owned by a single server process, so any run still marked as running when the store
+// is opened was orphaned by a previous process and is marked as interrupted.
+type FileRunStore struct {
+	mu   sync.Mutex
+	root *os.Root
+}
+
+func NewFileRunStore(dir string) (*FileRunStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating run store directory: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	rs := &FileRunStore{root: root}
+	if err := rs.interruptOrphans(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (rs *FileRunStore) Create(r RunRecord) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, err := rs.root.Stat(r.ID + recordExt); err == nil {
+		return fmt.Errorf("run %s already exists", r.ID)
+	}
+	if err := rs.root.WriteFile(r.ID+outputExt, nil, 0o640); err != nil {
+		return err
+	}
+	return rs.write(r)
+}
+
+func (rs *FileRunStore) Update(id string, fn func(r *RunRecord)) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, err := rs.read(id)
+	if err != nil {
+		return err
+	}
+	fn(&r)
+	r.ID = id
+	return rs.write(r)
+}
+
+func (rs *FileRunStore) Append(id string, lines ...string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	f, err := rs.root.OpenFile(id+outputExt, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrRunNotFound
+		}
+		return err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+func (rs *FileRunStore) Get(id string) (RunRecord, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.read(id)
+}
+
+func (rs *FileRunStore) Output(id string) ([]string, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	f, err := rs.root.Open(id + outputExt)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []string{}, ErrRunNotFound
+		}
+		return []string{}, err
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return []string{}, err
+	}
+	return lines, nil
+}
+
+// List returns every stored run, most recent first.
+func (rs *FileRunStore) List() ([]RunRecord, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.list()
+}
+
+func (rs *FileRunStore) list() ([]RunRecord, error) {
+	names, err := fs.Glob(rs.root.FS(), "*"+recordExt)
+	if err != nil {
+		return []RunRecord{}, err
+	}
+	records := make([]RunRecord, 0, len(names))
+	for _, name := range names {
+		r, err := rs.read(strings.TrimSuffix(name, recordExt))
+		if err != nil {
+			return []RunRecord{}, err
+		}
+		records = append(records, r)
+	}
+	slices.SortFunc(records, func(a, b RunRecord) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	return records, nil
+}
+
+func (rs *FileRunStore) interruptOrphans() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	records, err := rs.list()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.Done() {
+			continue
+		}
+		r.Status = RunStatusInterrupted
+		r.EndedAt = time.Now()
+		r.ExitCode = -1
+		if err := rs.write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *FileRunStore) read(id string) (RunRecord, error) {
+	data, err := rs.root.ReadFile(id + recordExt)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return RunRecord{}, ErrRunNotFound
+		}
+		return RunRecord{}, err
+	}
+	var r RunRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return RunRecord{}, fmt.Errorf("error decoding run %s: %w", id, err)
+	}
+	return r, nil
+}
+
+// write replaces the record via rename so readers never observe a partially written file.
+func (rs *FileRunStore) write(r RunRecord) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.ID + recordExt + ".tmp"
+	if err := rs.root.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return rs.root.Rename(tmp, r.ID+recordExt)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRunStore(t *testing.T) {
+	dir := t.TempDir()
+	rs, err := NewFileRunStore(dir)
+	if err != nil {
+		t.Fatalf("creating run store: %v", err)
+	}
+	started := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	err = rs.Create(RunRecord{ID: "first", Org: "gh-org", Patch: "example", Status: RunStatusRunning, StartedAt: started})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	err = rs.Create(RunRecord{ID: "second", Org: "gh-org", Patch: "example", Status: RunStatusRunning, StartedAt: started.Add(time.Minute)})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.NotNil(t, rs.Create(RunRecord{ID: "first"}), "Expected error creating a duplicate run")
+
+	assert.Nil(t, rs.Append("first", "line 1", "line 2"))
+	assert.Nil(t, rs.Append("first", "line 3"))
+	lines, err := rs.Output("first")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{"line 1", "line 2", "line 3"}, lines)
+
+	err = rs.Update("first", func(r *RunRecord) {
+		r.Status = RunStatusSucceeded
+	})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record, err := rs.Get("first")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, RunStatusSucceeded, record.Status)
+
+	records, err := rs.List()
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "second", records[0].ID, "Expected most recent run first")
+	}
+
+	_, err = rs.Get("../escape")
+	assert.NotNil(t, err, "Expected error reading outside of the store")
+	assert.ErrorIs(t, rs.Append("missing", "line"), ErrRunNotFound)
+
+	// reopening the store interrupts runs orphaned by the previous process
+	rs, err = NewFileRunStore(dir)
+	if err != nil {
+		t.Fatalf("reopening run store: %v", err)
+	}
+	record, err = rs.Get("second")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, RunStatusInterrupted, record.Status)
+}
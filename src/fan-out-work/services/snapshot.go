@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrPatchChanged   = errors.New("the patch has changed since its dry run, dry run it again")
+	ErrDryRunRequired = errors.New("a patch has to be dry run before it's run for real")
+	// ErrParametersChanged means a real run was given parameters other than the ones its dry run ran with.
+	ErrParametersChanged = errors.New("the parameters differ from the dry run's, dry run with them first")
+)
+
+// snapshotsDir holds a copy of the patch of every queued or running run. A run runs its copy, so changes to the
+// patches once it's been checked against its dry run, even halfway through it, don't change what it does.
+var snapshotsDir = stringFromEnv("PATCH_SNAPSHOT_DIR", filepath.Join(os.TempDir(), "fan-out-work-snapshots"))
+
+// snapshotPatch copies a patch into a folder of the run's own, returning that folder, which holds the patch
+// under its name the same way the patches directory does, and the revision of the patches it was copied at.
+func (fs *FanoutServiceImpl) snapshotPatch(streamName string, name string) (string, string, error) {
+	dir := filepath.Join(fs.snapshots, streamName)
+	revision, err := fs.source().Snapshot(name, filepath.Join(dir, name))
+	if err != nil {
+		fs.removeSnapshot(streamName)
+		return "", "", fmt.Errorf("error copying patch %s: %w", name, err)
+	}
+	return dir, revision, nil
+}
+
+// snapshotConfig reads the config of a run's copy of its patch, which may not be the config the catalog has.
+func snapshotConfig(dir string, name string) (config, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return config{}, err
+	}
+	defer root.Close()
+	cfg, err := validatePatch(root, name)
+	if err != nil {
+		return config{}, fmt.Errorf("patch %s is broken: %w", name, err)
+	}
+	return cfg, nil
+}
+
+func (fs *FanoutServiceImpl) removeSnapshot(streamName string) {
+	err := os.RemoveAll(filepath.Join(fs.snapshots, streamName))
+	if err != nil {
+		log.Printf("error removing patch snapshot: %v", err)
+	}
+}
+
+// hashPatch hashes the content of a patch's folder: the path, executable bit and content of every file in it.
+func hashPatch(dir string, name string) (string, error) {
+	patchesRoot, err := os.OpenRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	defer patchesRoot.Close()
+	patchRoot, err := patchesRoot.OpenRoot(name)
+	if err != nil {
+		return "", err
+	}
+	defer patchRoot.Close()
+	patchFS := patchRoot.FS()
+	h := sha256.New()
+	// WalkDir visits files in lexical order, so the hash doesn't depend on the order the OS lists them in
+	err = fs.WalkDir(patchFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := fs.Stat(patchFS, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%t\x00%d\x00", path, info.Mode().Perm()&0o111 != 0, info.Size())
+		f, err := patchFS.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error hashing patch %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkDryRun makes sure a real run follows a dry run of the same patch, in the same org, as it is now, with
+// the same parameters.
+func (fs *FanoutServiceImpl) checkDryRun(pr PatchRun, hash string, parameters map[string]string) error {
+	if pr.DryRunID == "" {
+		return ErrDryRunRequired
+	}
+	dryRun, err := fs.runStore.Get(pr.DryRunID)
+	if err != nil {
+		return fmt.Errorf("error getting dry run: %w", err)
+	}
+	if !dryRun.DryRun || dryRun.Org != pr.Org || dryRun.Patch != pr.Patch {
+		return fmt.Errorf("run %s isn't a dry run of %s in %s", pr.DryRunID, pr.Patch, pr.Org)
+	}
+	if dryRun.PatchHash != hash {
+		return ErrPatchChanged
+	}
+	if !maps.Equal(dryRun.Parameters, parameters) {
+		return ErrParametersChanged
+	}
+	return nil
+}
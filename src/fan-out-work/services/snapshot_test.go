@@ -0,0 +1,103 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPatch(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "example", "branch: b\npr-title: t\n")
+	hash, err := hashPatch(dir, "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	again, err := hashPatch(dir, "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, hash, again)
+
+	if err := os.Chmod(filepath.Join(dir, "example", "patch"), 0o644); err != nil {
+		t.Fatalf("chmod patch: %v", err)
+	}
+	unexecutable, err := hashPatch(dir, "example")
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.NotEqual(t, hash, unexecutable)
+}
+
+func TestRunPatchChangedSinceDryRun(t *testing.T) {
+	defer func(dir string) { patchDir = dir }(patchDir)
+	patchDir = t.TempDir()
+	writePatch(t, patchDir, "example", "branch: b\npr-title: t\n")
+	fs := NewMockFanoutService(t)
+	dryRunID, err := fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "example", DryRun: true})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+
+	pr := PatchRun{Org: "gh-org", Patch: "example", DryRunID: dryRunID}
+	runID, err := fs.Run(newContext(), pr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	record, err := fs.(*FanoutServiceImpl).runStore.Get(runID)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, dryRunID, record.DryRunID)
+	assert.NotEmpty(t, record.PatchHash)
+
+	err = os.WriteFile(filepath.Join(patchDir, "example", "patch"), []byte("#!/usr/bin/env bash\nrm -rf .\n"), 0o755)
+	if err != nil {
+		t.Fatalf("writing patch: %v", err)
+	}
+	_, err = fs.Run(newContext(), pr)
+	assert.ErrorIs(t, err, ErrPatchChanged)
+
+	_, err = fs.Run(newContext(), PatchRun{Org: "other-org", Patch: "example", DryRunID: dryRunID})
+	assert.EqualError(t, err, "run "+dryRunID+" isn't a dry run of example in other-org")
+
+	_, err = fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "example"})
+	assert.ErrorIs(t, err, ErrDryRunRequired)
+}
+
+func TestRunParametersChangedSinceDryRun(t *testing.T) {
+	defer func(dir string) { patchDir = dir }(patchDir)
+	patchDir = t.TempDir()
+	writePatch(t, patchDir, "bump", `
+branch: bump
+pr-title: Bump
+parameters:
+  - name: version
+    type: semver
+    required: true
+`)
+	fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+	dryRunID, err := fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "bump", DryRun: true, Parameters: map[string]string{"version": "2.0.0"}})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+
+	_, err = fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "bump", DryRunID: dryRunID, Parameters: map[string]string{"version": "3.0.0"}})
+	assert.ErrorIs(t, err, ErrParametersChanged)
+	entries, err := os.ReadDir(fs.snapshots)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Len(t, entries, 1, "Expected the refused run's copy of the patch to be removed")
+
+	_, err = fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "bump", DryRunID: dryRunID, Parameters: map[string]string{"version": "2.0.0"}})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+}
+
+func TestRunPatchSnapshot(t *testing.T) {
+	defer func(dir string) { patchDir = dir }(patchDir)
+	patchDir = t.TempDir()
+	writePatch(t, patchDir, "example", "branch: b\npr-title: t\n")
+	fs := NewMockFanoutService(t)
+	id, err := fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "example", DryRun: true})
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	snapshot := filepath.Join(fs.(*FanoutServiceImpl).snapshots, id, "example", "patch")
+	assert.Equal(t, snapshot, capturedArgs[1], "Expected the run to run its own copy of the patch")
+
+	err = os.WriteFile(filepath.Join(patchDir, "example", "patch"), []byte("#!/usr/bin/env bash\nrm -rf .\n"), 0o755)
+	if err != nil {
+		t.Fatalf("writing patch: %v", err)
+	}
+	script, err := os.ReadFile(snapshot)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, "#!/usr/bin/env bash\n", string(script), "Expected the run's copy not to change with the patch")
+
+	fs.(*FanoutServiceImpl).removeSnapshot(id)
+	assert.NoDirExists(t, filepath.Dir(filepath.Dir(snapshot)))
+}
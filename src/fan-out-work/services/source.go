@@ -0,0 +1,260 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PatchSource is where patches come from.
+type PatchSource interface {
+	// Dir is the directory holding the patches, one folder each.
+	Dir() string
+	// Revision identifies the version of the patches, e.g. a commit SHA; it's empty when they aren't versioned.
+	Revision() string
+	// Snapshot copies a patch as it is now into dir, returning the revision it was copied at.
+	Snapshot(name string, dir string) (string, error)
+}
+
+// LocalPatchSource reads patches from a directory as they are.
+type LocalPatchSource struct {
+	dir string
+}
+
+func NewLocalPatchSource(dir string) *LocalPatchSource {
+	return &LocalPatchSource{dir: dir}
+}
+
+func (s *LocalPatchSource) Dir() string {
+	return s.dir
+}
+
+func (s *LocalPatchSource) Revision() string {
+	return ""
+}
+
+func (s *LocalPatchSource) Snapshot(name string, dir string) (string, error) {
+	patchesRoot, err := os.OpenRoot(s.dir)
+	if err != nil {
+		return "", err
+	}
+	defer patchesRoot.Close()
+	patchRoot, err := patchesRoot.OpenRoot(name)
+	if err != nil {
+		return "", err
+	}
+	defer patchRoot.Close()
+	return "", os.CopyFS(dir, patchRoot.FS())
+}
+
+var (
+	patchGitURL          = os.Getenv("PATCH_GIT_URL")
+	patchGitRef          = os.Getenv("PATCH_GIT_REF")
+	patchGitPath         = stringFromEnv("PATCH_GIT_PATH", ".")
+	patchGitCacheDir     = stringFromEnv("PATCH_GIT_CACHE_DIR", "./patch-cache")
+	patchGitSyncInterval = durationFromEnv("PATCH_GIT_SYNC_INTERVAL", 5*time.Minute)
+)
+
+// GitPatchSource keeps a checkout of a branch or tag of a git repository in a cache directory.
+type GitPatchSource struct {
+	url      string
+	ref      string // the remote's default branch if empty
+	path     string // the patches' folder within the repository
+	cacheDir string
+	mu       sync.RWMutex
+	revision string
+}
+
+func NewGitPatchSource(url string, ref string, path string, cacheDir string) *GitPatchSource {
+	return &GitPatchSource{url: url, ref: ref, path: path, cacheDir: cacheDir}
+}
+
+func (s *GitPatchSource) Dir() string {
+	return filepath.Join(s.cacheDir, s.path)
+}
+
+func (s *GitPatchSource) Revision() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision
+}
+
+// Snapshot copies a patch out of the commit the checkout is at rather than out of the checkout itself, which a
+// sync can change at any moment.
+func (s *GitPatchSource) Snapshot(name string, dir string) (string, error) {
+	revision := s.Revision()
+	if revision == "" {
+		return "", errors.New("patches haven't been synced")
+	}
+	// <revision>:<path> is the tree of the folder holding the patches
+	tree := revision + ":"
+	if path := filepath.ToSlash(filepath.Clean(s.path)); path != "." {
+		tree += path
+	}
+	cmd := gitCommand("-C", s.cacheDir, "archive", "--format=tar", tree, "--", name)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return "", err
+	}
+	extractErr := extractPatch(tar.NewReader(stdout), name, dir)
+	// the rest of the archive has to be read for git to exit
+	_, _ = io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+	if err != nil {
+		return "", gitError("archive", err, stderr.String())
+	}
+	if extractErr != nil {
+		return "", fmt.Errorf("error extracting patch %s: %w", name, extractErr)
+	}
+	return revision, nil
+}
+
+// extractPatch writes the files of a patch's folder in an archive into dir.
+func extractPatch(archive *tar.Reader, name string, dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	for {
+		hdr, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, ok := strings.CutPrefix(hdr.Name, name+"/")
+		if !ok || rel == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = root.MkdirAll(rel, 0o755)
+		case tar.TypeSymlink:
+			err = root.Symlink(hdr.Linkname, rel)
+		case tar.TypeReg:
+			var f *os.File
+			f, err = root.OpenFile(rel, os.O_CREATE|os.O_EXCL|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+			if err == nil {
+				_, err = io.Copy(f, archive)
+				err = errors.Join(err, f.Close())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Sync brings the checkout up to date with the remote ref, cloning it the first time.
+func (s *GitPatchSource) Sync() error {
+	_, err := os.Stat(filepath.Join(s.cacheDir, ".git"))
+	switch {
+	case os.IsNotExist(err):
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if s.ref != "" {
+			args = append(args, "--branch", s.ref)
+		}
+		if _, err := git(append(args, "--", s.url, s.cacheDir)...); err != nil {
+			return fmt.Errorf("error cloning patches: %w", err)
+		}
+	case err != nil:
+		return err
+	default:
+		ref := s.ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := git("-C", s.cacheDir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+			return fmt.Errorf("error fetching patches: %w", err)
+		}
+		if _, err := git("-C", s.cacheDir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return fmt.Errorf("error checking out patches: %w", err)
+		}
+	}
+	revision, err := git("-C", s.cacheDir, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("error reading patches revision: %w", err)
+	}
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch syncs the checkout every interval, keeping the last good checkout when a sync fails.
+func (s *GitPatchSource) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Sync(); err != nil {
+			log.Printf("error syncing patches, keeping revision %s: %v", s.Revision(), err)
+		}
+	}
+}
+
+func git(args ...string) (string, error) {
+	cmd := gitCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", gitError(args[0], err, stderr.String())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	// never prompt for credentials, there's no one to answer
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+// gitError reports a failed git command along with what it printed, which ends up in the logs, so credentials
+// in PATCH_GIT_URL are taken out of it.
+func gitError(command string, err error, stderr string) error {
+	return fmt.Errorf("git %s: %w: %s", command, err, redactCredentials(strings.TrimSpace(stderr)))
+}
+
+// urlCredentialsRegex matches the credentials of a URL, e.g. x-access-token:<token>@ in
+// https://x-access-token:<token>@github.com/org/patches.git.
+var urlCredentialsRegex = regexp.MustCompile(`://[^/@\s]+@`)
+
+func redactCredentials(s string) string {
+	return urlCredentialsRegex.ReplaceAllString(s, "://")
+}
+
+// NewPatchSource returns the configured git repository when PATCH_GIT_URL is set and it can be synced, and
+// otherwise the local patches directory.
+func NewPatchSource() PatchSource {
+	if patchGitURL == "" {
+		return NewLocalPatchSource(patchDir)
+	}
+	source := NewGitPatchSource(patchGitURL, patchGitRef, patchGitPath, patchGitCacheDir)
+	if err := source.Sync(); err != nil {
+		log.Printf("error syncing patches, falling back to %s: %v", patchDir, err)
+		return NewLocalPatchSource(patchDir)
+	}
+	go source.Watch(patchGitSyncInterval)
+	return source
+}
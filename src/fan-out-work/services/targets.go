@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TargetFilter narrows a repository search by a yes/no property such as whether a repository is archived.
+type TargetFilter string
+
+const (
+	TargetFilterAny     TargetFilter = ""
+	TargetFilterExclude TargetFilter = "exclude"
+	TargetFilterOnly    TargetFilter = "only"
+)
+
+// Targets picks the repositories in an org that a patch runs against. With no targets a run covers every
+// repository in the org.
+type Targets struct {
+	Repos    []string     `yaml:"repos" json:"repos,omitempty"`   // repository names, optionally prefixed with the org
+	Topics   []string     `yaml:"topics" json:"topics,omitempty"` // repositories with at least one of the topics
+	Search   string       `yaml:"search" json:"search,omitempty"` // a GitHub repository search query, scoped to the org
+	Language string       `yaml:"language" json:"language,omitempty"`
+	Archived TargetFilter `yaml:"archived" json:"archived,omitempty"`
+	Forks    TargetFilter `yaml:"forks" json:"forks,omitempty"`
+	Include  []string     `yaml:"include" json:"include,omitempty"` // repository name globs, e.g. service-*
+	Exclude  []string     `yaml:"exclude" json:"exclude,omitempty"`
+}
+
+func (t Targets) IsZero() bool {
+	return len(t.Repos) == 0 && len(t.Topics) == 0 && t.Search == "" && t.Language == "" &&
+		t.Archived == TargetFilterAny && t.Forks == TargetFilterAny && len(t.Include) == 0 && len(t.Exclude) == 0
+}
+
+// merge overrides the targets with every field set in overrides.
+func (t Targets) merge(overrides Targets) Targets {
+	if len(overrides.Repos) > 0 {
+		t.Repos = overrides.Repos
+	}
+	if len(overrides.Topics) > 0 {
+		t.Topics = overrides.Topics
+	}
+	if overrides.Search != "" {
+		t.Search = overrides.Search
+	}
+	if overrides.Language != "" {
+		t.Language = overrides.Language
+	}
+	if overrides.Archived != TargetFilterAny {
+		t.Archived = overrides.Archived
+	}
+	if overrides.Forks != TargetFilterAny {
+		t.Forks = overrides.Forks
+	}
+	if len(overrides.Include) > 0 {
+		t.Include = overrides.Include
+	}
+	if len(overrides.Exclude) > 0 {
+		t.Exclude = overrides.Exclude
+	}
+	return t
+}
+
+// ownerQualifiers are the repository search qualifiers that pick out whose repositories are searched.
+var ownerQualifiers = []string{"org", "user", "owner", "repo"}
+
+func (t Targets) validate(org string) error {
+	for _, repo := range t.Repos {
+		owner, _, found := strings.Cut(repo, "/")
+		if found && owner != org {
+			return fmt.Errorf("repository %s is not in org %s", repo, org)
+		}
+	}
+	if strings.ContainsFunc(t.Language, unicode.IsSpace) || strings.Contains(t.Language, ":") {
+		return fmt.Errorf("invalid language %q", t.Language)
+	}
+	// the whole search is checked rather than just its search field, so that no target can add an owner
+	search := strings.Join(t.qualifiers(), " ")
+	for _, term := range strings.Fields(search) {
+		// these would widen the search beyond the org it's scoped to
+		qualifier, _, found := strings.Cut(strings.TrimLeft(term, `-("`), ":")
+		if found && slices.Contains(ownerQualifiers, strings.ToLower(qualifier)) {
+			return fmt.Errorf("search %q can't use the %s: qualifier, it's already scoped to org %s", search, qualifier, org)
+		}
+	}
+	for _, filter := range []TargetFilter{t.Archived, t.Forks} {
+		if !slices.Contains([]TargetFilter{TargetFilterAny, TargetFilterExclude, TargetFilterOnly}, filter) {
+			return fmt.Errorf("invalid target filter %q, expected %q or %q", filter, TargetFilterExclude, TargetFilterOnly)
+		}
+	}
+	for _, pattern := range slices.Concat(t.Include, t.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// query is the repository search the targets imply, or empty if they don't need one.
+func (t Targets) query(org string) string {
+	qualifiers := t.qualifiers()
+	if len(qualifiers) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{"org:" + org}, qualifiers...), " ")
+}
+
+// qualifiers are the terms the targets add to the org in a repository search.
+func (t Targets) qualifiers() []string {
+	var qualifiers []string
+	if t.Search != "" {
+		qualifiers = append(qualifiers, t.Search)
+	}
+	if t.Language != "" {
+		qualifiers = append(qualifiers, "language:"+t.Language)
+	}
+	switch t.Archived {
+	case TargetFilterExclude:
+		qualifiers = append(qualifiers, "archived:false")
+	case TargetFilterOnly:
+		qualifiers = append(qualifiers, "archived:true")
+	}
+	switch t.Forks {
+	case TargetFilterExclude:
+		qualifiers = append(qualifiers, "fork:false")
+	case TargetFilterOnly:
+		qualifiers = append(qualifiers, "fork:only")
+	}
+	return qualifiers
+}
+
+// args maps the targets onto multi-gitter's repository options. Explicit repositories and a search add to each
+// other, otherwise the whole org is targeted; topics and globs then narrow that set down.
+func (t Targets) args(org string, repos []string) []string {
+	var args []string
+	for _, repo := range t.Repos {
+		if !strings.Contains(repo, "/") {
+			repo = org + "/" + repo
+		}
+		args = append(args, "--repo", repo)
+	}
+	if query := t.query(org); query != "" {
+		args = append(args, "--repo-search", query)
+	}
+	if len(args) == 0 {
+		args = append(args, "--org", org)
+	}
+	for _, topic := range t.Topics {
+		args = append(args, "--topic", topic)
+	}
+	for _, repo := range t.skipped(repos) {
+		args = append(args, "--skip-repo", org+"/"+repo)
+	}
+	return args
+}
+
+// skipped returns the repositories that the include and exclude globs rule out.
+func (t Targets) skipped(repos []string) []string {
+	var skipped []string
+	for _, repo := range repos {
+		included := len(t.Include) == 0 || slices.ContainsFunc(t.Include, func(pattern string) bool {
+			matched, _ := path.Match(pattern, repo)
+			return matched
+		})
+		excluded := slices.ContainsFunc(t.Exclude, func(pattern string) bool {
+			matched, _ := path.Match(pattern, repo)
+			return matched
+		})
+		if !included || excluded {
+			skipped = append(skipped, repo)
+		}
+	}
+	return skipped
+}
+
+// targetArgs resolves a run's targets into multi-gitter arguments, listing the org's repositories when globs
+// need matching against them.
+func (fs *FanoutServiceImpl) targetArgs(c echo.Context, org string, t Targets) ([]string, error) {
+	var repos []string
+	if len(t.Include) > 0 || len(t.Exclude) > 0 {
+		var err error
+		repos, err = fs.githubService.Repos(c, org)
+		if err != nil {
+			return []string{}, fmt.Errorf("error listing repositories: %w", err)
+		}
+	}
+	return t.args(org, repos), nil
+}
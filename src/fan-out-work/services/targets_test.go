@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		targets  Targets
+		expected []string
+	}{
+		{
+			name:     "whole org",
+			expected: []string{"--org", "gh-org"},
+		},
+		{
+			name:     "repos",
+			targets:  Targets{Repos: []string{"api", "gh-org/web"}},
+			expected: []string{"--repo", "gh-org/api", "--repo", "gh-org/web"},
+		},
+		{
+			name:     "topics",
+			targets:  Targets{Topics: []string{"go"}},
+			expected: []string{"--org", "gh-org", "--topic", "go"},
+		},
+		{
+			name:     "search",
+			targets:  Targets{Search: "in:readme deprecated", Language: "go", Archived: TargetFilterExclude, Forks: TargetFilterOnly},
+			expected: []string{"--repo-search", "org:gh-org in:readme deprecated language:go archived:false fork:only"},
+		},
+		{
+			name:     "globs",
+			targets:  Targets{Include: []string{"web*"}, Exclude: []string{"*-legacy"}},
+			expected: []string{"--org", "gh-org", "--skip-repo", "gh-org/api", "--skip-repo", "gh-org/web-legacy"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := NewMockFanoutService(t).(*FanoutServiceImpl)
+			args, err := fs.targetArgs(newContext(), "gh-org", tc.targets)
+			assert.Nil(t, err, "Expected nil error, got %v", err)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+}
+
+func TestTargetsOverride(t *testing.T) {
+	configured := Targets{Topics: []string{"go"}, Exclude: []string{"*-legacy"}}
+	merged := configured.merge(Targets{Topics: []string{"python"}})
+	assert.Equal(t, Targets{Topics: []string{"python"}, Exclude: []string{"*-legacy"}}, merged)
+}
+
+func TestTargetsValidate(t *testing.T) {
+	assert.Nil(t, Targets{Repos: []string{"api", "gh-org/web"}}.validate("gh-org"))
+	assert.EqualError(t, Targets{Repos: []string{"other/web"}}.validate("gh-org"), "repository other/web is not in org gh-org")
+	assert.Nil(t, Targets{Search: "in:readme deprecated topic:go"}.validate("gh-org"))
+	for _, search := range []string{"org:other", "deprecated user:octocat", "REPO:other/web", "-org:gh-org"} {
+		assert.ErrorContains(t, Targets{Search: search}.validate("gh-org"), "already scoped to org gh-org", "Expected %q to be refused", search)
+	}
+	for _, language := range []string{"go org:other", "go user:someone", "org:other"} {
+		assert.NotNil(t, Targets{Language: language}.validate("gh-org"), "Expected language %q to be refused", language)
+	}
+	assert.Nil(t, Targets{Language: "go"}.validate("gh-org"))
+	assert.NotNil(t, Targets{Archived: "sometimes"}.validate("gh-org"))
+	assert.NotNil(t, Targets{Include: []string{"["}}.validate("gh-org"))
+}
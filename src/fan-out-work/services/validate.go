@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Patch is a folder in the patches directory, along with whatever stops it from being run. The catalog details
+// come from its config.yml, and README from an optional README.md next to it.
+type Patch struct {
+	Name        string
+	Problem     error // nil for a patch that can be run
+	Description string
+	Owner       string // who to ask about the patch, e.g. a team
+	Tags        []string
+	Deprecated  bool
+	README      string // markdown
+	cfg         config
+}
+
+func (p Patch) Valid() bool {
+	return p.Problem == nil
+}
+
+var ErrPatchNotFound = errors.New("invalid patch name")
+
+// ValidatePatches checks every patch in dir, in name order.
+func ValidatePatches(dir string) ([]Patch, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return []Patch{}, err
+	}
+	defer root.Close()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []Patch{}, err
+	}
+	var patches []Patch
+	for _, e := range entries {
+		// hidden folders, such as .git when patches come from a repository, aren't patches
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		cfg, err := validatePatch(root, e.Name())
+		readme, readmeErr := readPatchREADME(root, e.Name())
+		patches = append(patches, Patch{
+			Name:        e.Name(),
+			Problem:     errors.Join(err, readmeErr),
+			Description: cfg.Description,
+			Owner:       cfg.Owner,
+			Tags:        cfg.Tags,
+			Deprecated:  cfg.Deprecated,
+			README:      readme,
+			cfg:         cfg,
+		})
+	}
+	return patches, nil
+}
+
+// validatePatch checks that a patch has a valid config.yml and an executable patch script, returning its
+// config.
+func validatePatch(patchesRoot *os.Root, name string) (config, error) {
+	patchRoot, err := patchesRoot.OpenRoot(name)
+	if err != nil {
+		return config{}, err
+	}
+	defer patchRoot.Close()
+	var errs []error
+	var cfg config
+	cfgData, err := patchRoot.ReadFile("config.yml")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error reading config.yml: %w", err))
+	} else if cfg, err = parseConfig(cfgData); err != nil {
+		errs = append(errs, fmt.Errorf("invalid config.yml: %w", err))
+	}
+	if err := validatePatchScript(patchRoot); err != nil {
+		errs = append(errs, err)
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// readPatchREADME reads a patch's README.md, which is optional.
+func readPatchREADME(patchesRoot *os.Root, name string) (string, error) {
+	data, err := patchesRoot.ReadFile(filepath.Join(name, "README.md"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading README.md: %w", err)
+	}
+	return string(data), nil
+}
+
+func validatePatchScript(patchRoot *os.Root) error {
+	info, err := patchRoot.Stat("patch")
+	if err != nil {
+		return fmt.Errorf("error reading patch: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("patch must be a regular file")
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return errors.New("patch must be executable")
+	}
+	f, err := patchRoot.Open("patch")
+	if err != nil {
+		return fmt.Errorf("error reading patch: %w", err)
+	}
+	defer f.Close()
+	shebang := make([]byte, 2)
+	_, err = io.ReadFull(f, shebang)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading patch: %w", err)
+	}
+	// compiled executables don't need one, but a script without one can't be run directly
+	if !bytes.Equal(shebang, []byte("#!")) && !isBinary(f) {
+		return errors.New("patch must start with a shebang, e.g. #!/usr/bin/env bash")
+	}
+	return nil
+}
+
+// isBinary reports whether a file looks like a compiled executable rather than text.
+func isBinary(f *os.File) bool {
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	return bytes.IndexByte(head[:n], 0) >= 0
+}
+
+// patch looks up a patch that can be run.
+func (fs *FanoutServiceImpl) patch(name string) (Patch, error) {
+	patches, err := fs.Patches()
+	if err != nil {
+		return Patch{}, err
+	}
+	i := slices.IndexFunc(patches, func(p Patch) bool {
+		return p.Name == name
+	})
+	if i < 0 {
+		return Patch{}, fmt.Errorf("%w: %s", ErrPatchNotFound, name)
+	}
+	if !patches[i].Valid() {
+		return Patch{}, fmt.Errorf("patch %s is broken: %w", name, patches[i].Problem)
+	}
+	return patches[i], nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePatches(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "good", "branch: b\npr-title: t\n")
+	writePatch(t, dir, "bad-config", "branch: b\npr-title: '{{.Nope}}'\nreviewer: octocat\n")
+	writePatch(t, dir, "not-executable", "branch: b\npr-title: t\n")
+	if err := os.Chmod(filepath.Join(dir, "not-executable", "patch"), 0o644); err != nil {
+		t.Fatalf("chmod patch: %v", err)
+	}
+	writePatch(t, dir, "no-shebang", "branch: b\npr-title: t\n")
+	if err := os.WriteFile(filepath.Join(dir, "no-shebang", "patch"), []byte("echo hi\n"), 0o755); err != nil {
+		t.Fatalf("writing patch: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatalf("creating patch: %v", err)
+	}
+
+	patches, err := ValidatePatches(dir)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	problems := map[string]error{}
+	for _, p := range patches {
+		problems[p.Name] = p.Problem
+	}
+	assert.Len(t, problems, 5)
+	assert.Nil(t, problems["good"])
+	assert.ErrorContains(t, problems["bad-config"], "field reviewer not found")
+	assert.ErrorContains(t, problems["not-executable"], "patch must be executable")
+	assert.ErrorContains(t, problems["no-shebang"], "patch must start with a shebang")
+	assert.ErrorContains(t, problems["empty"], "error reading config.yml")
+	assert.ErrorContains(t, problems["empty"], "error reading patch")
+}
+
+func TestRunBrokenPatch(t *testing.T) {
+	defer func(dir string) { patchDir = dir }(patchDir)
+	patchDir = t.TempDir()
+	writePatch(t, patchDir, "broken", "branch: b\n")
+	fs := NewMockFanoutService(t)
+	_, err := fs.Run(newContext(), PatchRun{Org: "gh-org", Patch: "broken"})
+	assert.EqualError(t, err, "patch broken is broken: invalid config.yml: pr-title is required")
+}
+
+func TestValidatePatchesCatalogDetails(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "documented", "description: Bumps Go\nowner: '@acme/platform'\ntags: [go, deps]\ndeprecated: true\nbranch: b\npr-title: t\n")
+	if err := os.WriteFile(filepath.Join(dir, "documented", "README.md"), []byte("# Bump Go\n"), 0o644); err != nil {
+		t.Fatalf("writing README.md: %v", err)
+	}
+	writePatch(t, dir, "undocumented", "branch: b\npr-title: t\n")
+
+	patches, err := ValidatePatches(dir)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Len(t, patches, 2)
+	documented := patches[0]
+	assert.Nil(t, documented.Problem)
+	assert.Equal(t, "Bumps Go", documented.Description)
+	assert.Equal(t, "@acme/platform", documented.Owner)
+	assert.Equal(t, []string{"go", "deps"}, documented.Tags)
+	assert.True(t, documented.Deprecated)
+	assert.Equal(t, "# Bump Go\n", documented.README)
+	assert.Nil(t, patches[1].Problem)
+	assert.Empty(t, patches[1].README)
+}
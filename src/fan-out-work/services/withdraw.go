@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrNothingToWithdraw = errors.New("there are no open pull requests to withdraw")
+
+// WithdrawRun closes the open PRs a patch opened across an org, for when the patch turns out to be wrong.
+type WithdrawRun struct {
+	AccessToken    string
+	User           string
+	Org            string
+	Patch          string
+	Comment        string // posted on each PR before it's closed, if set
+	DeleteBranches bool
+}
+
+// Withdraw closes a patch's open PRs, streaming each outcome as the output of a run, and then brings the
+// patch's tracking issue up to date.
+func (fs *FanoutServiceImpl) Withdraw(c echo.Context, wr WithdrawRun) (string, error) {
+	patch, err := fs.patch(wr.Patch)
+	if err != nil {
+		return "", err
+	}
+	branch := patch.cfg.Branch
+	pullRequests, err := fs.githubService.PullRequests(wr.AccessToken, wr.Org, branch, patch.cfg.headOwner(wr.Org))
+	if err != nil {
+		return "", fmt.Errorf("error listing pull requests: %w", err)
+	}
+	var open []PullRequest
+	for _, pr := range pullRequests {
+		if pr.State == PullRequestOpen {
+			open = append(open, pr)
+		}
+	}
+	if len(open) == 0 {
+		return "", ErrNothingToWithdraw
+	}
+	comment := strings.TrimSpace(wr.Comment)
+	streamName, err := fs.submitPullRequestRun(pullRequestRun{
+		record: RunRecord{
+			Kind:           RunKindWithdraw,
+			User:           wr.User,
+			Org:            wr.Org,
+			Patch:          wr.Patch,
+			Comment:        comment,
+			DeleteBranches: wr.DeleteBranches,
+		},
+		pullRequests: open,
+		act: func(pr PullRequest) (string, *RepoResult) {
+			label := pullRequestLabel(pr)
+			result := &RepoResult{Repo: pr.Repo, PRURL: pr.URL, PRNumber: pr.Number, Outcome: RepoOutcomeWithdrawn}
+			err := fs.withdrawPullRequest(wr.AccessToken, pr, branch, comment, wr.DeleteBranches)
+			if err != nil {
+				result.Outcome = RepoOutcomeFailed
+				result.Error = err.Error()
+				return fmt.Sprintf("failed to withdraw %s: %v", label, err), result
+			}
+			if wr.DeleteBranches {
+				return fmt.Sprintf("withdrew %s and deleted %s", label, branch), result
+			}
+			return "withdrew " + label, result
+		},
+		finish: func(streamName string) {
+			// the checklist strikes through the PRs that have just been closed
+			pullRequests, err := fs.githubService.PullRequests(wr.AccessToken, wr.Org, branch, patch.cfg.headOwner(wr.Org))
+			if err != nil {
+				fs.appendOutput(streamName, fmt.Sprintf("error listing pull requests: %v", err))
+				return
+			}
+			issueLink, err := fs.updateTrackingIssue(wr.AccessToken, wr.Org, patch, pullRequests)
+			if err != nil {
+				fs.appendOutput(streamName, fmt.Sprintf("error updating tracking issue: %v", err))
+				return
+			}
+			err = fs.runStore.Update(streamName, func(r *RunRecord) {
+				r.IssueURL = issueLink
+			})
+			if err != nil {
+				fs.appendOutput(streamName, fmt.Sprintf("error recording tracking issue: %v", err))
+			}
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error recording withdrawal: %w", err)
+	}
+	return streamName, nil
+}
+
+func (fs *FanoutServiceImpl) withdrawPullRequest(token string, pr PullRequest, branch string, comment string, deleteBranch bool) error {
+	if comment != "" {
+		err := fs.githubService.CommentOnPullRequest(token, pr.Repo, pr.Number, comment)
+		if err != nil {
+			return err
+		}
+	}
+	err := fs.githubService.ClosePullRequest(token, pr.Repo, pr.Number)
+	if err != nil {
+		return err
+	}
+	if deleteBranch {
+		// the branch is in the fork for PRs from forks
+		return fs.githubService.DeleteBranch(token, pr.HeadRepo, branch)
+	}
+	return nil
+}
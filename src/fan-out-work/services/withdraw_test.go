@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdraw(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/repo-1", Number: 1, URL: "pr 1", State: PullRequestOpen, HeadRepo: "acme-bot/repo-1"},
+		{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestMerged},
+		{Repo: "gh-org/unclosable", Number: 3, URL: "pr 3", State: PullRequestOpen, HeadRepo: "gh-org/unclosable"},
+	}
+	capturedWithdrawals = nil
+	capturedIssue = Issue{}
+	fs := NewMockFanoutService(t)
+	wr := WithdrawRun{
+		User:           "octocat",
+		Org:            "gh-org",
+		Patch:          "example",
+		Comment:        " This patch breaks the build. ",
+		DeleteBranches: true,
+	}
+	id, err := fs.Withdraw(newContext(), wr)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	runStore := fs.(*FanoutServiceImpl).runStore
+	record := waitForRun(t, runStore, id)
+	assert.Equal(t, RunKindWithdraw, record.Kind)
+	assert.Equal(t, "This patch breaks the build.", record.Comment)
+	assert.True(t, record.DeleteBranches)
+	assert.Equal(t, RunStatusFailed, record.Status)
+	assert.Equal(t, "issue link", record.IssueURL)
+	assert.Equal(t, []string{
+		"comment on gh-org/repo-1 #1: This patch breaks the build.",
+		"close gh-org/repo-1 #1",
+		"delete acme-bot/repo-1 example-patch-pr-branch",
+		"comment on gh-org/unclosable #3: This patch breaks the build.",
+	}, capturedWithdrawals)
+	assert.Equal(t, []RepoResult{
+		{Repo: "gh-org/repo-1", Outcome: RepoOutcomeWithdrawn, PRURL: "pr 1", PRNumber: 1},
+		{Repo: "gh-org/unclosable", Outcome: RepoOutcomeFailed, PRURL: "pr 3", PRNumber: 3, Error: "resource not accessible by integration"},
+	}, record.Results)
+	lines, err := runStore.Output(id)
+	assert.Nil(t, err, "Expected nil error, got %v", err)
+	assert.Equal(t, []string{
+		"withdrew gh-org/repo-1 #1 and deleted example-patch-pr-branch",
+		"failed to withdraw gh-org/unclosable #3: resource not accessible by integration",
+	}, lines)
+	assert.Equal(t, "Example PR Title", capturedIssue.Title)
+}
+
+func TestWithdrawNothing(t *testing.T) {
+	defer chdir(t, "..")()
+	defer func(pullRequests []PullRequest) {
+		mockPullRequests = pullRequests
+	}(mockPullRequests)
+	mockPullRequests = []PullRequest{
+		{Repo: "gh-org/repo-2", Number: 2, URL: "pr 2", State: PullRequestMerged},
+	}
+	fs := NewMockFanoutService(t)
+	_, err := fs.Withdraw(newContext(), WithdrawRun{Org: "gh-org", Patch: "example"})
+	assert.ErrorIs(t, err, ErrNothingToWithdraw)
+}
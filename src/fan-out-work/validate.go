@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bradshjg/fan-out-work/services"
+)
+
+// validate checks every patch in dir, reporting each one, and returns the exit code: 1 if any patch is
+// broken.
+func validate(dir string, w io.Writer) int {
+	patches, err := services.ValidatePatches(dir)
+	if err != nil {
+		fmt.Fprintf(w, "error reading patches: %v\n", err)
+		return 1
+	}
+	code := 0
+	for _, patch := range patches {
+		if patch.Valid() {
+			fmt.Fprintf(w, "ok   %s\n", patch.Name)
+			continue
+		}
+		code = 1
+		fmt.Fprintf(w, "FAIL %s\n", patch.Name)
+		fmt.Fprintf(w, "     %s\n", strings.ReplaceAll(patch.Problem.Error(), "\n", "\n     "))
+	}
+	return code
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePatch(t *testing.T, dir string, name string, cfg string) {
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatalf("creating patch: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "config.yml"), []byte(cfg), 0o644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "patch"), []byte("#!/usr/bin/env bash\n"), 0o755); err != nil {
+		t.Fatalf("writing patch: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	writePatch(t, dir, "good", "branch: b\npr-title: t\n")
+	var out strings.Builder
+	assert.Equal(t, 0, validate(dir, &out))
+	assert.Equal(t, "ok   good\n", out.String())
+
+	writePatch(t, dir, "broken", "branch: b\n")
+	out.Reset()
+	assert.Equal(t, 1, validate(dir, &out))
+	assert.Equal(t, "FAIL broken\n     invalid config.yml: pr-title is required\nok   good\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, validate(filepath.Join(dir, "missing"), &out))
+	assert.Contains(t, out.String(), "error reading patches:")
+}
@@ -8,7 +8,13 @@ package views
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-func IndexContent(authenticated bool, orgs []string, patches []string) templ.Component {
+import (
+	"time"
+
+	"github.com/bradshjg/fan-out-work/services"
+)
+
+func IndexContent(authenticated bool, orgs []string, patches []services.Patch, patchesLoadedAt time.Time) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -39,12 +45,20 @@ func IndexContent(authenticated bool, orgs []string, patches []string) templ.Com
 				return templ_7745c5c3_Err
 			}
 		} else {
-			templ_7745c5c3_Err = DryRunForm(orgs, patches).Render(ctx, templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<div style=\"display: flex; flex-direction: column\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = DryRunForm(orgs, patches, patchesLoadedAt).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<a data-testid=\"catalog-link\" href=\"/patches\" style=\"margin-top: 1em;\">patch catalog</a> <a data-testid=\"history-link\" href=\"/history\" style=\"margin-top: 1em;\">run history</a></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "</div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -52,7 +66,7 @@ func IndexContent(authenticated bool, orgs []string, patches []string) templ.Com
 	})
 }
 
-func Index(authenticated bool, orgs []string, patches []string) templ.Component {
+func Index(authenticated bool, orgs []string, patches []services.Patch, patchesLoadedAt time.Time) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -85,7 +99,7 @@ func Index(authenticated bool, orgs []string, patches []string) templ.Component
 				}()
 			}
 			ctx = templ.InitializeContext(ctx)
-			templ_7745c5c3_Err = IndexContent(authenticated, orgs, patches).Render(ctx, templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = IndexContent(authenticated, orgs, patches, patchesLoadedAt).Render(ctx, templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
@@ -0,0 +1,77 @@
+package views
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/a-h/templ"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// readmeMarkdown renders a patch's README. Raw HTML is left out, as goldmark does unless it's told otherwise,
+// so a README can't inject anything into the page.
+var readmeMarkdown = goldmark.New(
+	goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(readmeTransformer{}, 100))),
+)
+
+func markdown(src string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		return readmeMarkdown.Convert([]byte(src), w)
+	})
+}
+
+// readmeTransformer fits a README into the catalog page: its headings nest under the page's own, and links,
+// autolinks included, and images that aren't to web pages are reduced to their text. Relative ones would
+// resolve against the catalog page rather than the patch's folder, and other schemes, such as javascript:,
+// aren't safe.
+type readmeTransformer struct{}
+
+func (readmeTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var unwrap []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			n.Level = min(n.Level+2, 6)
+		case *ast.Link:
+			if !markdownLinkAllowed(string(n.Destination)) {
+				unwrap = append(unwrap, n)
+			}
+		case *ast.Image:
+			if !markdownLinkAllowed(string(n.Destination)) {
+				unwrap = append(unwrap, n)
+			}
+		case *ast.AutoLink:
+			// goldmark lets any scheme through in <scheme:...> links
+			if n.AutoLinkType == ast.AutoLinkURL && !markdownLinkAllowed(string(n.URL(source))) {
+				unwrap = append(unwrap, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range unwrap {
+		parent := n.Parent()
+		if autoLink, ok := n.(*ast.AutoLink); ok {
+			parent.ReplaceChild(parent, n, ast.NewString(autoLink.Label(source)))
+			continue
+		}
+		for child := n.FirstChild(); child != nil; child = n.FirstChild() {
+			n.RemoveChild(n, child)
+			parent.InsertBefore(parent, n, child)
+		}
+		parent.RemoveChild(parent, n)
+	}
+}
+
+func markdownLinkAllowed(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
@@ -0,0 +1,60 @@
+package views
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdown(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "headings nest under the page's",
+			src:      "# Foo\n\n##### Deep",
+			expected: "<h3>Foo</h3>\n<h6>Deep</h6>\n",
+		},
+		{
+			name:     "nesting",
+			src:      "- **bold `code`** and [a *link*](https://go.dev)\n  1. nested",
+			expected: "<ul>\n<li><strong>bold <code>code</code></strong> and <a href=\"https://go.dev\">a <em>link</em></a>\n<ol>\n<li>nested</li>\n</ol>\n</li>\n</ul>\n",
+		},
+		{
+			name:     "unclosed markers",
+			src:      "**bold `code [link](https://go.dev",
+			expected: "<p>**bold `code [link](https://go.dev</p>\n",
+		},
+		{
+			name:     "relative links",
+			src:      "see [the patch](./patch) and ![diagram](diagram.png)",
+			expected: "<p>see the patch and diagram</p>\n",
+		},
+		{
+			name:     "unsafe links",
+			src:      "[click](javascript:alert(1)) <javascript:alert(1)>",
+			expected: "<p>click javascript:alert(1)</p>\n",
+		},
+		{
+			name:     "raw HTML",
+			src:      "<script>alert(1)</script>\n\nhi <img src=x onerror=alert(1)>",
+			expected: "<!-- raw HTML omitted -->\n<p>hi <!-- raw HTML omitted --></p>\n",
+		},
+		{
+			name:     "escaping",
+			src:      "a < b & \"c\"\n\n```\n<b>&amp;</b>\n```",
+			expected: "<p>a &lt; b &amp; &quot;c&quot;</p>\n<pre><code>&lt;b&gt;&amp;amp;&lt;/b&gt;\n</code></pre>\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			err := markdown(tc.src).Render(context.Background(), &b)
+			assert.Nil(t, err, "Expected nil error, got %v", err)
+			assert.Equal(t, tc.expected, b.String())
+		})
+	}
+}